@@ -0,0 +1,220 @@
+package makefile
+
+// Pos is the position of a node in a makefile.
+type Pos struct {
+	// Line is the 1-based line number
+	Line int
+	// Col is the 1-based column number
+	Col int
+}
+
+// Node is a top-level construct in a makefile.
+type Node interface {
+	Position() Pos
+}
+
+// File is a parsed makefile.
+type File struct {
+	// Path is the path of the makefile, if it was parsed from disk
+	Path  string
+	Nodes []Node
+}
+
+// Comment is a comment on a line of its own.
+type Comment struct {
+	Pos Pos
+	// Text is the comment without the leading '#'
+	Text string
+}
+
+// Rule is a rule with its recipe, e.g.
+//
+//	a b: c d | e ; echo inline
+//		echo recipe
+type Rule struct {
+	Pos Pos
+	// EndLine is the last line of the rule header, which is after Pos.Line
+	// if the header has line continuations
+	EndLine int
+	Targets []string
+	// Prerequisites are the normal prerequisites
+	Prerequisites []string
+	// OrderOnly are the prerequisites after the '|'
+	OrderOnly []string
+	// DoubleColon is true for rules defined with '::'
+	DoubleColon bool
+	// Pattern is the target pattern of a static pattern rule,
+	// e.g. %.o in `objs: %.o: %.c`
+	Pattern string
+	Recipe  []*RecipeLine
+	// Doc are the comments directly above the rule
+	Doc []*Comment
+}
+
+// RecipeLine is a single line of a recipe without the recipe prefix.
+// Lines joined by a backslash continuation are a single RecipeLine.
+type RecipeLine struct {
+	Pos  Pos
+	Text string
+	// Inline is true for the recipe after a ';' on the rule line
+	Inline bool
+}
+
+// Assignment is a variable assignment, e.g.
+//
+//	override FOO := bar
+//	target: FOO = bar
+type Assignment struct {
+	Pos  Pos
+	Name string
+	// Op is one of =, :=, ::=, :::=, ?=, += or !=
+	Op    string
+	Value string
+	// Targets are the targets of a target-specific assignment
+	Targets  []string
+	Export   bool
+	Override bool
+	// Define is true if the variable was set in a define block
+	Define bool
+}
+
+// Include is an include directive.
+type Include struct {
+	Pos   Pos
+	Paths []string
+	// Optional is true for -include and sinclude
+	Optional bool
+	// Files are the parsed included files, only set by ParseFile
+	Files []*File
+}
+
+// Conditional is an ifeq, ifneq, ifdef or ifndef block. An `else ifeq`
+// chain is represented as a Conditional in Else.
+type Conditional struct {
+	Pos       Pos
+	Directive string
+	// Args are the arguments of the directive, e.g. `($(A),b)` for ifeq
+	Args string
+	Then []Node
+	Else []Node
+}
+
+// Directive is any other directive, such as export, unexport or vpath.
+type Directive struct {
+	Pos  Pos
+	Name string
+	Args string
+}
+
+// Expansion is a line that is only known after expanding it,
+// e.g. $(eval $(call rule,x)).
+type Expansion struct {
+	Pos  Pos
+	Text string
+}
+
+func (n *Comment) Position() Pos     { return n.Pos }
+func (n *Expansion) Position() Pos   { return n.Pos }
+func (n *Rule) Position() Pos        { return n.Pos }
+func (n *Assignment) Position() Pos  { return n.Pos }
+func (n *Include) Position() Pos     { return n.Pos }
+func (n *Conditional) Position() Pos { return n.Pos }
+func (n *Directive) Position() Pos   { return n.Pos }
+
+// Walk calls fn for every node in the file, including the nodes in both
+// branches of conditionals and in included files.
+func (f *File) Walk(fn func(Node)) {
+	walk(f.Nodes, fn)
+}
+
+func walk(nodes []Node, fn func(Node)) {
+	for _, n := range nodes {
+		fn(n)
+		switch n := n.(type) {
+		case *Conditional:
+			walk(n.Then, fn)
+			walk(n.Else, fn)
+		case *Include:
+			for _, f := range n.Files {
+				walk(f.Nodes, fn)
+			}
+		}
+	}
+}
+
+// Rules returns every rule in the file.
+func (f *File) Rules() []*Rule {
+	var rules []*Rule
+	f.Walk(func(n Node) {
+		if r, ok := n.(*Rule); ok {
+			rules = append(rules, r)
+		}
+	})
+	return rules
+}
+
+// Phony returns the targets that are prerequisites of .PHONY.
+func (f *File) Phony() map[string]bool {
+	phony := map[string]bool{}
+	for _, r := range f.Rules() {
+		for _, t := range r.Targets {
+			if t != ".PHONY" {
+				continue
+			}
+			for _, p := range r.Prerequisites {
+				phony[p] = true
+			}
+		}
+	}
+	return phony
+}
+
+// Targets returns the names of the targets that can be run directly, in the
+// order they are first defined. Special targets, pattern rules and targets
+// that are only known after expanding variables are left out.
+func (f *File) Targets() []string {
+	seen := map[string]bool{}
+	var targets []string
+	for _, r := range f.Rules() {
+		if r.Pattern != "" {
+			continue
+		}
+		for _, t := range r.Targets {
+			if seen[t] || !isRunnableTarget(t) {
+				continue
+			}
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// Target returns the target with the given name, merging the prerequisites
+// of every rule that defines it. It returns nil if there is no such target.
+func (f *File) Target(name string) *Target {
+	var target *Target
+	for _, r := range f.Rules() {
+		var defines bool
+		for _, t := range r.Targets {
+			defines = defines || t == name
+		}
+		if !defines {
+			continue
+		}
+		if target == nil {
+			target = &Target{Name: name, Pos: r.Pos}
+		}
+		target.Prerequisites = append(target.Prerequisites, r.Prerequisites...)
+		target.Prerequisites = append(target.Prerequisites, r.OrderOnly...)
+		if target.Body == "" {
+			for _, l := range r.Recipe {
+				target.Body += "\t" + l.Text + "\n"
+			}
+		}
+	}
+	if target != nil {
+		target.Phony = f.Phony()[name]
+	}
+	return target
+}
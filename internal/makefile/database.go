@@ -0,0 +1,97 @@
+package makefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	dbFilesStart = "# Files"
+	dbFilesEnd   = "# files hash-table stats:"
+	dbNotTarget  = "# Not a target:"
+	dbPhony      = "#  Phony target (prerequisite of .PHONY)."
+)
+
+// ParseDatabase parses the database that `make -p` prints and returns the
+// targets that can be run directly, sorted by name. Unlike Parse this sees
+// targets from included files and $(eval ...), because make has already
+// expanded them.
+func ParseDatabase(r io.Reader) ([]*Target, error) {
+	scan := bufio.NewScanner(r)
+	scan.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	targets := map[string]*Target{}
+	var inFiles, notTarget bool
+	var current *Target
+	for scan.Scan() {
+		line := scan.Text()
+		if !inFiles {
+			inFiles = line == dbFilesStart
+			continue
+		}
+		switch {
+		case line == dbFilesEnd:
+			return sortTargets(targets), nil
+		case line == "":
+			// a blank line ends the entry
+			current, notTarget = nil, false
+		case line == dbNotTarget:
+			notTarget = true
+		case line == dbPhony:
+			if current != nil {
+				current.Phony = true
+			}
+		case strings.HasPrefix(line, "\t"):
+			if current != nil {
+				current.Body += "\t" + strings.TrimSpace(line) + "\n"
+			}
+		case strings.HasPrefix(line, "#"):
+		case !notTarget:
+			f, err := Parse(strings.NewReader(line))
+			if err != nil {
+				return nil, fmt.Errorf("make database: %w", err)
+			}
+			for _, n := range f.Nodes {
+				r, ok := n.(*Rule)
+				if !ok {
+					// target-specific variables
+					continue
+				}
+				for _, name := range r.Targets {
+					if !isRunnableTarget(name) {
+						continue
+					}
+					t := targets[name]
+					if t == nil {
+						t = &Target{Name: name}
+						targets[name] = t
+					}
+					t.Prerequisites = append(t.Prerequisites, r.Prerequisites...)
+					t.Prerequisites = append(t.Prerequisites, r.OrderOnly...)
+					current = t
+				}
+			}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("error reading make database: %w", err)
+	}
+	if !inFiles {
+		return nil, fmt.Errorf("make database: no %q section", dbFilesStart)
+	}
+	return sortTargets(targets), nil
+}
+
+func sortTargets(targets map[string]*Target) []*Target {
+	sorted := make([]*Target, 0, len(targets))
+	for _, t := range targets {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
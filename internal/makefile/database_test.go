@@ -0,0 +1,77 @@
+package makefile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// database is trimmed output of `make -pRrq` for a makefile that includes a
+// file and defines targets with $(eval ...).
+const database = `# GNU Make 4.3
+# Variables
+
+FOO := x
+
+# Files
+
+gen-b:
+#  Implicit rule search has not been done.
+#  recipe to execute (from 'Makefile', line 8):
+	echo b
+
+lint:
+#  Implicit rule search has not been done.
+# automatic
+# @ := lint
+#  recipe to execute (from 'inc.mk', line 1):
+	 echo lint
+
+# Not a target:
+Makefile:
+#  Implicit rule search has been done.
+
+# Not a target:
+out:
+#  File has not been updated.
+
+# makefile (from 'Makefile', line 10)
+run: FOO = bar
+run: build | out
+#  Phony target (prerequisite of .PHONY).
+#  recipe to execute (from 'Makefile', line 12):
+	# run it
+	echo run
+
+build::
+#  recipe to execute (from 'Makefile', line 15):
+	echo b
+
+.PHONY: run
+#  File has not been updated.
+
+# files hash-table stats:
+# Load=11/1024=1%, Rehash=0, Collisions=2/31=6%
+
+not-a-file:
+`
+
+func TestParseDatabase(t *testing.T) {
+	got, err := ParseDatabase(strings.NewReader(database))
+	if err != nil {
+		t.Fatalf("ParseDatabase() error = %v", err)
+	}
+	want := []*Target{
+		{Name: "build", Body: "\techo b\n"},
+		{Name: "gen-b", Body: "\techo b\n"},
+		{Name: "lint", Body: "\techo lint\n"},
+		{Name: "run", Prerequisites: []string{"build", "out"}, Body: "\t# run it\n\techo run\n", Phony: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDatabase() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseDatabase(strings.NewReader("make: *** No rule to make target\n")); err == nil {
+		t.Errorf("ParseDatabase() without a database should fail")
+	}
+}
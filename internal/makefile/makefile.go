@@ -1,9 +1,6 @@
 package makefile
 
 import (
-	"bufio"
-	"fmt"
-	"go/scanner"
 	"io"
 	"strings"
 )
@@ -12,177 +9,127 @@ type Makefile struct {
 	Targets []string
 }
 
-var internalTargets = []string{
-	".PHONY",
-	".SUFFIXES",
-	".DEFAULT",
-	".PRECIOUS",
-	".INTERMEDIATE",
-	".SECONDARY",
-	".SECONDEXPANSION",
-	".DELETE_ON_ERROR",
-	".IGNORE",
-	".LOW_RESOLUTION_TIME",
-	".SILENT",
-	".EXPORT_ALL_VARIABLES",
-	".NOTPARALLEL",
-	".ONESHELL",
-	".POSIX",
-	".SHELLFLAGS",
-	".FEATURES",
-	".MAKE",
-	".FEATURES",
-	".VARIABLES",
-	".MAKEFILE_LIST",
-	".MAKEFLAGS",
-	".TARGETS",
-	".THIS_FILE",
-	".DEFAULT_GOAL",
-	".RECIPEPREFIX",
-	".SHELL",
-	".LIBPATTERNS",
+// specialTargets are the targets that make treats specially. They are never
+// run directly.
+var specialTargets = map[string]bool{
+	".PHONY":                true,
+	".SUFFIXES":             true,
+	".DEFAULT":              true,
+	".PRECIOUS":             true,
+	".INTERMEDIATE":         true,
+	".NOTINTERMEDIATE":      true,
+	".SECONDARY":            true,
+	".SECONDEXPANSION":      true,
+	".DELETE_ON_ERROR":      true,
+	".IGNORE":               true,
+	".LOW_RESOLUTION_TIME":  true,
+	".SILENT":               true,
+	".EXPORT_ALL_VARIABLES": true,
+	".NOTPARALLEL":          true,
+	".ONESHELL":             true,
+	".POSIX":                true,
+	".WAIT":                 true,
 }
 
-func ParseMakefile(file io.Reader) (*Makefile, error) {
-	mf := Makefile{}
-	// get the targets from the makefile
-	scan := bufio.NewScanner(file)
-	for scan.Scan() {
-		// targets follow the format [target]: [dependencies]
-		// we only care about the target
-		scanned := scan.Text()
-		if len(scanned) == 0 {
-			continue
-		}
-		if scanned[0] == '#' {
-			continue
-		}
-		if scanned[0] == '.' {
-			continue
-		}
-		if scanned[0] == '\t' {
-			continue
-		}
-		if scanned[0] == ' ' {
-			continue
-		}
-		if scanned[0] == '\n' {
-			continue
-		}
-		if scanned[0] == '\r' {
-			continue
-		}
-
-		// check if this is an internal target
-		for _, internalTarget := range internalTargets {
-			if scanned == internalTarget {
-				continue
-			}
-		}
-
-		// check if this is a variable
-		if scanned[0] == '$' {
-			continue
-		}
-
-		// check if this is a function
-		if scanned[0] == '%' {
-			continue
-		}
-
-		// if the line contains a string up until ': ' or ':\n' then it is a target
-		if isTarget(scanned) {
-			target := strings.Split(scanned, ":")[0]
-			mf.Targets = append(mf.Targets, target)
-		}
+// isRunnableTarget returns false for special targets, suffix rules such as
+// .c.o, pattern rules and targets that reference variables.
+func isRunnableTarget(name string) bool {
+	if specialTargets[name] {
+		return false
 	}
-	if err := scan.Err(); err != nil {
-		if err, ok := err.(*scanner.Error); ok {
-			return nil, fmt.Errorf("%s:%d:%d: %s", err.Pos.Filename, err.Pos.Line, err.Pos.Column, err.Msg)
-		}
-		return nil, fmt.Errorf("error scanning makefile: %w", err)
+	// suffix rules and hidden files are never run directly
+	if strings.HasPrefix(name, ".") {
+		return false
 	}
-
-	return &mf, nil
+	return !strings.ContainsAny(name, "%$")
 }
 
-func isTarget(str string) bool {
-	// if the line contains a string up until ': ' or ':\n' then it is a target
-	if (strings.Contains(str, ": ") || strings.Contains(str, ":")) && !strings.Contains(str, " :") {
-		return true
+// ParseMakefile returns the targets of the makefile that can be run directly.
+func ParseMakefile(file io.Reader) (*Makefile, error) {
+	f, err := Parse(file)
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return &Makefile{Targets: f.Targets()}, nil
 }
 
+// GetTarget returns the target with the given name, or nil if the makefile
+// doesn't define it or can't be parsed.
 func GetTarget(name string, f io.Reader) *Target {
-	scan := bufio.NewScanner(f)
-	var target *Target
-	for scan.Scan() {
-		scanned := scan.Text()
-		if len(scanned) == 0 {
-			continue
-		}
-		if target != nil {
-			// if we've reached the end of the target, return it
-			if scanned[0] != '\t' {
-				return target
-			}
+	file, err := Parse(f)
+	if err != nil {
+		return nil
+	}
+	return file.Target(name)
+}
 
-			target.Body += scanned + "\n"
-			continue
-		}
+type Target struct {
+	Name string
+	// Pos is the position of the first rule that defines the target
+	Pos Pos
+	// Prerequisites are the normal and order-only prerequisites of every rule
+	// that defines the target
+	Prerequisites []string
+	// Body is the recipe, with every line prefixed by a tab
+	Body  string
+	Phony bool
+}
 
-		if scanned[0] == '#' {
-			continue
-		}
-		if scanned[0] == '.' {
+// RemovePrerequisites removes every prerequisite for which remove returns true
+// from the rules in the makefile. It reports whether anything was removed.
+// Rules that change are rewritten on a single line.
+func RemovePrerequisites(src string, remove func(prereq string) bool) (string, bool, error) {
+	f, err := Parse(strings.NewReader(src))
+	if err != nil {
+		return "", false, err
+	}
+
+	lines := strings.Split(src, "\n")
+	var changed bool
+	for _, r := range f.Rules() {
+		prereqs, removedPrereqs := filterPrereqs(r.Prerequisites, remove)
+		orderOnly, removedOrderOnly := filterPrereqs(r.OrderOnly, remove)
+		if !removedPrereqs && !removedOrderOnly {
 			continue
 		}
-		if scanned[0] == '\t' {
-			continue
+		changed = true
+
+		header := strings.Join(r.Targets, " ") + ":"
+		if r.DoubleColon {
+			header += ":"
 		}
-		if scanned[0] == ' ' {
-			continue
+		if r.Pattern != "" {
+			header += " " + r.Pattern + ":"
 		}
-		if scanned[0] == '\n' {
-			continue
+		if len(prereqs) > 0 {
+			header += " " + strings.Join(prereqs, " ")
 		}
-		if scanned[0] == '\r' {
-			continue
+		if len(orderOnly) > 0 {
+			header += " | " + strings.Join(orderOnly, " ")
 		}
-
-		// check if this is an internal target
-		for _, internalTarget := range internalTargets {
-			if scanned == internalTarget {
-				continue
-			}
+		if len(r.Recipe) > 0 && r.Recipe[0].Inline {
+			header += "; " + r.Recipe[0].Text
 		}
 
-		// check if this is a variable
-		if scanned[0] == '$' {
-			continue
+		// replace the header, keeping the line count the same so that make
+		// reports the same line numbers
+		lines[r.Pos.Line-1] = header
+		for i := r.Pos.Line; i < r.EndLine; i++ {
+			lines[i] = ""
 		}
+	}
+	return strings.Join(lines, "\n"), changed, nil
+}
 
-		// check if this is a function
-		if scanned[0] == '%' {
+func filterPrereqs(prereqs []string, remove func(string) bool) ([]string, bool) {
+	var kept []string
+	var removed bool
+	for _, p := range prereqs {
+		if remove(p) {
+			removed = true
 			continue
 		}
-
-		// if the line contains a string up until ': ' or ':\n' then it is a target
-		if isTarget(scanned) {
-			targetName := strings.Split(scanned, ":")[0]
-			if targetName == name {
-				target = &Target{
-					Name: name,
-				}
-			}
-		}
+		kept = append(kept, p)
 	}
-
-	return target
-}
-
-type Target struct {
-	Name string
-	Body string
+	return kept, removed
 }
@@ -0,0 +1,540 @@
+package makefile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseError is a syntax error in a makefile.
+type ParseError struct {
+	Path string
+	Pos  Pos
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Pos.Line, e.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.Pos.Line, e.Msg)
+}
+
+// Parse parses a makefile. Included files are recorded but not parsed,
+// use ParseFile to follow them.
+func Parse(r io.Reader) (*File, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading makefile: %w", err)
+	}
+	return parse("", string(b))
+}
+
+// ParseFile parses the makefile at path and the files it includes. Includes
+// are resolved relative to the directory of the including file, and ones
+// that reference variables or don't exist are skipped.
+func ParseFile(path string) (*File, error) {
+	return parseFile(path, map[string]bool{})
+}
+
+func parseFile(path string, visited map[string]bool) (*File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	visited[abs] = true
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parse(path, string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	var includes []*Include
+	f.Walk(func(n Node) {
+		if inc, ok := n.(*Include); ok {
+			includes = append(includes, inc)
+		}
+	})
+	for _, inc := range includes {
+		for _, p := range inc.Paths {
+			if strings.Contains(p, "$") {
+				continue
+			}
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(filepath.Dir(path), p)
+			}
+			matches, err := filepath.Glob(p)
+			if err != nil {
+				continue
+			}
+			for _, m := range matches {
+				if abs, err := filepath.Abs(m); err != nil || visited[abs] {
+					continue
+				}
+				included, err := parseFile(m, visited)
+				if err != nil {
+					return nil, err
+				}
+				inc.Files = append(inc.Files, included)
+			}
+		}
+	}
+	return f, nil
+}
+
+type parser struct {
+	path  string
+	lines []string
+	// next is the index of the next line to read
+	next         int
+	recipePrefix byte
+
+	file *File
+	// blocks are the open conditionals, innermost last
+	blocks []*condBlock
+	// rule is the rule that recipe lines are added to
+	rule *Rule
+	// doc are the comments since the last blank line or node
+	doc []*Comment
+}
+
+type condBlock struct {
+	cond   *Conditional
+	inElse bool
+	// chained is true for the conditional of an `else ifeq`, which is
+	// closed by the same endif as its parent
+	chained bool
+}
+
+func parse(path, src string) (*File, error) {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	p := &parser{
+		path:         path,
+		lines:        strings.Split(src, "\n"),
+		recipePrefix: '\t',
+		file:         &File{Path: path},
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+func (p *parser) errorf(line int, format string, args ...interface{}) error {
+	return &ParseError{Path: p.path, Pos: Pos{Line: line, Col: 1}, Msg: fmt.Sprintf(format, args...)}
+}
+
+// add adds a node to the innermost open conditional, or the file.
+func (p *parser) add(n Node) {
+	if len(p.blocks) == 0 {
+		p.file.Nodes = append(p.file.Nodes, n)
+		return
+	}
+	b := p.blocks[len(p.blocks)-1]
+	if b.inElse {
+		b.cond.Else = append(b.cond.Else, n)
+	} else {
+		b.cond.Then = append(b.cond.Then, n)
+	}
+}
+
+func (p *parser) parse() error {
+	for p.next < len(p.lines) {
+		raw := p.lines[p.next]
+		lineNo := p.next + 1
+
+		if p.rule != nil && len(raw) > 0 && raw[0] == p.recipePrefix {
+			p.rule.Recipe = append(p.rule.Recipe, &RecipeLine{
+				Pos:  Pos{Line: lineNo, Col: 2},
+				Text: p.recipeLine(),
+			})
+			continue
+		}
+
+		line := p.logicalLine()
+		code, comment, hasComment := stripComment(line)
+		trimmed := strings.TrimSpace(code)
+
+		if trimmed == "" {
+			if hasComment {
+				c := &Comment{Pos: Pos{Line: lineNo, Col: strings.Index(line, "#") + 1}, Text: comment}
+				p.add(c)
+				p.doc = append(p.doc, c)
+			} else {
+				p.doc = nil
+			}
+			continue
+		}
+
+		col := len(code) - len(strings.TrimLeft(code, " \t")) + 1
+		if err := p.parseLine(trimmed, Pos{Line: lineNo, Col: col}); err != nil {
+			return err
+		}
+	}
+
+	if len(p.blocks) > 0 {
+		return p.errorf(p.blocks[len(p.blocks)-1].cond.Pos.Line, "missing endif")
+	}
+	return nil
+}
+
+// parseLine parses a logical line that isn't part of a recipe.
+func (p *parser) parseLine(line string, pos Pos) error {
+	word, args := cutWord(line)
+
+	switch word {
+	case "ifeq", "ifneq", "ifdef", "ifndef":
+		cond := &Conditional{Pos: pos, Directive: word, Args: args}
+		p.add(cond)
+		p.blocks = append(p.blocks, &condBlock{cond: cond})
+		p.doc = nil
+		return nil
+	case "else":
+		if len(p.blocks) == 0 {
+			return p.errorf(pos.Line, "else without a matching if")
+		}
+		b := p.blocks[len(p.blocks)-1]
+		if b.inElse {
+			return p.errorf(pos.Line, "only one else per conditional")
+		}
+		b.inElse = true
+		if args != "" {
+			directive, condArgs := cutWord(args)
+			switch directive {
+			case "ifeq", "ifneq", "ifdef", "ifndef":
+			default:
+				return p.errorf(pos.Line, "unexpected text after else")
+			}
+			cond := &Conditional{Pos: pos, Directive: directive, Args: condArgs}
+			p.add(cond)
+			p.blocks = append(p.blocks, &condBlock{cond: cond, chained: true})
+		}
+		p.doc = nil
+		return nil
+	case "endif":
+		if len(p.blocks) == 0 {
+			return p.errorf(pos.Line, "endif without a matching if")
+		}
+		for len(p.blocks) > 0 && p.blocks[len(p.blocks)-1].chained {
+			p.blocks = p.blocks[:len(p.blocks)-1]
+		}
+		p.blocks = p.blocks[:len(p.blocks)-1]
+		p.doc = nil
+		return nil
+	case "include", "-include", "sinclude":
+		p.add(&Include{Pos: pos, Paths: strings.Fields(args), Optional: word != "include"})
+		p.endNode()
+		return nil
+	case "endef":
+		return p.errorf(pos.Line, "endef without a matching define")
+	}
+
+	export, override, rest := cutModifiers(line)
+	switch w, a := cutWord(rest); w {
+	case "define":
+		return p.parseDefine(a, pos, export, override)
+	case "unexport", "vpath":
+		if !export && !override {
+			p.add(&Directive{Pos: pos, Name: w, Args: a})
+			p.endNode()
+			return nil
+		}
+	}
+
+	if rest == "" {
+		// e.g. `export` on its own
+		p.add(&Directive{Pos: pos, Name: strings.TrimSpace(line)})
+		p.endNode()
+		return nil
+	}
+
+	i, kind := findSeparator(rest)
+	switch kind {
+	case sepAssign:
+		a := parseAssignment(rest, i)
+		a.Pos, a.Export, a.Override = pos, export, override
+		p.addAssignment(a)
+		return nil
+	case sepRule:
+		if export || override {
+			// e.g. `export FOO` followed by something make would reject anyway
+			break
+		}
+		return p.parseRule(rest, i, pos)
+	}
+
+	if export {
+		p.add(&Directive{Pos: pos, Name: "export", Args: rest})
+		p.endNode()
+		return nil
+	}
+	if strings.Contains(rest, "$") {
+		// only known after expansion, e.g. $(eval $(call rule,x))
+		p.add(&Expansion{Pos: pos, Text: rest})
+		p.endNode()
+		return nil
+	}
+	return p.errorf(pos.Line, "missing separator")
+}
+
+func (p *parser) addAssignment(a *Assignment) {
+	if a.Name == ".RECIPEPREFIX" && len(a.Targets) == 0 {
+		p.recipePrefix = '\t'
+		if a.Value != "" {
+			p.recipePrefix = a.Value[0]
+		}
+	}
+	p.add(a)
+	p.endNode()
+}
+
+// endNode ends the recipe context and the doc comments.
+func (p *parser) endNode() {
+	p.rule = nil
+	p.doc = nil
+}
+
+func (p *parser) parseRule(line string, i int, pos Pos) error {
+	r := &Rule{Pos: pos, EndLine: p.next, Targets: strings.Fields(line[:i]), Doc: p.doc}
+	rest := line[i+1:]
+	if strings.HasPrefix(rest, ":") {
+		r.DoubleColon = true
+		rest = rest[1:]
+	}
+
+	// target-specific variables, e.g. `target: FOO = bar`
+	if j, kind := findSeparator(rest); kind == sepAssign {
+		a := parseAssignment(rest, j)
+		a.Pos = pos
+		a.Targets = r.Targets
+		p.addAssignment(a)
+		return nil
+	}
+
+	var inline string
+	var hasInline bool
+	if j := indexTopLevel(rest, ';'); j >= 0 {
+		inline = strings.TrimSpace(rest[j+1:])
+		hasInline = true
+		rest = rest[:j]
+	}
+
+	// static pattern rules, e.g. `objs: %.o: %.c`. Labels such as
+	// //pkg:target contain colons too, but never a '%' before them.
+	if j := indexTopLevel(rest, ':'); j >= 0 && strings.Contains(rest[:j], "%") {
+		r.Pattern = strings.TrimSpace(rest[:j])
+		rest = rest[j+1:]
+	}
+
+	normal := rest
+	if j := indexTopLevel(rest, '|'); j >= 0 {
+		normal = rest[:j]
+		r.OrderOnly = strings.Fields(rest[j+1:])
+	}
+	r.Prerequisites = strings.Fields(normal)
+
+	if hasInline {
+		r.Recipe = append(r.Recipe, &RecipeLine{Pos: Pos{Line: r.EndLine, Col: 1}, Text: inline, Inline: true})
+	}
+
+	p.add(r)
+	p.rule = r
+	p.doc = nil
+	return nil
+}
+
+func (p *parser) parseDefine(args string, pos Pos, export, override bool) error {
+	name, op := cutWord(args)
+	if name == "" {
+		return p.errorf(pos.Line, "empty variable name")
+	}
+	if op == "" {
+		op = "="
+	}
+
+	var body []string
+	depth := 1
+	for p.next < len(p.lines) {
+		line := p.lines[p.next]
+		p.next++
+		w, _ := cutWord(strings.TrimSpace(line))
+		switch w {
+		case "define":
+			depth++
+		case "endef":
+			depth--
+		}
+		if depth == 0 {
+			p.addAssignment(&Assignment{
+				Pos:      pos,
+				Name:     name,
+				Op:       op,
+				Value:    strings.Join(body, "\n"),
+				Export:   export,
+				Override: override,
+				Define:   true,
+			})
+			return nil
+		}
+		body = append(body, line)
+	}
+	return p.errorf(pos.Line, "missing endef")
+}
+
+// logicalLine returns the next line with backslash continuations joined by a
+// single space, as make does outside of recipes.
+func (p *parser) logicalLine() string {
+	line := p.lines[p.next]
+	p.next++
+	for continues(line) && p.next < len(p.lines) {
+		line = strings.TrimRight(line[:len(line)-1], " \t") + " " + strings.TrimLeft(p.lines[p.next], " \t")
+		p.next++
+	}
+	return line
+}
+
+// recipeLine returns the next recipe line without the recipe prefix. Backslash
+// continuations are kept as they are passed to the shell, but the recipe
+// prefix of the continued lines is removed.
+func (p *parser) recipeLine() string {
+	line := p.lines[p.next][1:]
+	p.next++
+	for continues(line) && p.next < len(p.lines) {
+		next := p.lines[p.next]
+		if len(next) > 0 && next[0] == p.recipePrefix {
+			next = next[1:]
+		}
+		line += "\n" + next
+		p.next++
+	}
+	return line
+}
+
+// continues returns true if the line ends with an odd number of backslashes
+func continues(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// stripComment splits the line at the first unescaped '#'.
+func stripComment(line string) (code, comment string, hasComment bool) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '#':
+			return line[:i], strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return line, "", false
+}
+
+// cutModifiers removes the export, override and private modifiers from the
+// start of an assignment.
+func cutModifiers(line string) (export, override bool, rest string) {
+	rest = line
+	for {
+		w, a := cutWord(rest)
+		switch w {
+		case "export":
+			export = true
+		case "override":
+			override = true
+		case "private":
+		default:
+			return export, override, rest
+		}
+		rest = a
+	}
+}
+
+// cutWord splits off the first whitespace separated word.
+func cutWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i+1:])
+}
+
+type separator int
+
+const (
+	sepNone separator = iota
+	sepAssign
+	sepRule
+)
+
+// findSeparator finds the first ':' or '=' outside of variable references,
+// which decides whether the line is a rule or an assignment. For assignments
+// the index is of the '=' and for rules of the ':'.
+func findSeparator(s string) (int, separator) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$' && i+1 < len(s) && (s[i+1] == '(' || s[i+1] == '{'):
+			depth++
+			i++
+		case (c == ')' || c == '}') && depth > 0:
+			depth--
+		case depth > 0:
+		case c == '=':
+			return i, sepAssign
+		case c == ':':
+			// :=, ::= and :::=
+			j := i
+			for j < len(s) && s[j] == ':' {
+				j++
+			}
+			if j < len(s) && s[j] == '=' && j-i <= 3 {
+				return j, sepAssign
+			}
+			return i, sepRule
+		}
+	}
+	return -1, sepNone
+}
+
+// parseAssignment parses an assignment whose '=' is at i.
+func parseAssignment(s string, i int) *Assignment {
+	start := i
+	for start > 0 && strings.ContainsRune(":?+!", rune(s[start-1])) {
+		start--
+		// only one of ?, + or ! is part of the operator
+		if s[start] != ':' {
+			break
+		}
+	}
+	return &Assignment{
+		Name:  strings.TrimSpace(s[:start]),
+		Op:    s[start : i+1],
+		Value: strings.TrimLeft(s[i+1:], " \t"),
+	}
+}
+
+// indexTopLevel returns the index of the first c outside of variable references.
+func indexTopLevel(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && (s[i+1] == '(' || s[i+1] == '{'):
+			depth++
+			i++
+		case (s[i] == ')' || s[i] == '}') && depth > 0:
+			depth--
+		case depth == 0 && s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
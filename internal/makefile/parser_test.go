@@ -0,0 +1,184 @@
+package makefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFile_Targets(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "simple",
+			src:  "build:\n\techo build\ntest: build\n\techo test\n",
+			want: []string{"build", "test"},
+		},
+		{
+			name: "multiple targets in one rule",
+			src:  "a b c:\n\techo $@\n",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "double colon",
+			src:  "clean::\n\trm a\nclean::\n\trm b\n",
+			want: []string{"clean"},
+		},
+		{
+			name: "assignments are not targets",
+			src:  "FOO := bar\nBAR ::= baz\nQUX ?= 1\nLIST += x\nSH != echo hi\nrun:\n\techo $(FOO)\n",
+			want: []string{"run"},
+		},
+		{
+			name: "target-specific variable",
+			src:  "run: FOO = bar\nrun:\n\techo $(FOO)\n",
+			want: []string{"run"},
+		},
+		{
+			name: "special, pattern and suffix rules",
+			src:  ".PHONY: run\n%.o: %.c\n\tcc $<\n.c.o:\n\tcc $<\n$(BIN): main.go\nrun:\n\techo\n",
+			want: []string{"run"},
+		},
+		{
+			name: "define block",
+			src:  "define RULE\nfake: x\n\techo\nendef\nrun:\n\techo\n",
+			want: []string{"run"},
+		},
+		{
+			name: "conditionals",
+			src:  "ifeq ($(OS),Windows_NT)\nwin:\n\techo\nelse ifdef LINUX\nlinux:\n\techo\nelse\nmac:\n\techo\nendif\n",
+			want: []string{"win", "linux", "mac"},
+		},
+		{
+			name: "continuation",
+			src:  "run: a \\\n\tb\n\techo \\\n\t\tdone\n",
+			want: []string{"run"},
+		},
+		{
+			name: "recipe prefix",
+			src:  ".RECIPEPREFIX = >\nrun:\n> echo run\nbuild:\n> echo build\n",
+			want: []string{"run", "build"},
+		},
+		{
+			name: "comments",
+			src:  "# run: the thing\nrun: ## help\n\techo # not a comment\n",
+			want: []string{"run"},
+		},
+		{
+			name: "eval",
+			src:  "$(eval $(call rule,x))\nrun:\n\techo\n",
+			want: []string{"run"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := f.Targets(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Targets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_Target(t *testing.T) {
+	src := `.PHONY: deploy
+
+# deploy the api
+deploy: build //services/auth:build | out
+	echo deploy
+	echo \
+		done
+deploy: test
+static: %.o: %.c
+`
+	f, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got := f.Target("deploy")
+	want := &Target{
+		Name:          "deploy",
+		Pos:           Pos{Line: 4, Col: 1},
+		Prerequisites: []string{"build", "//services/auth:build", "out", "test"},
+		Body:          "\techo deploy\n\techo \\\n\tdone\n",
+		Phony:         true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Target() = %+v, want %+v", got, want)
+	}
+	if got := f.Target("missing"); got != nil {
+		t.Errorf("Target(missing) = %+v, want nil", got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+	}{
+		{name: "missing separator", src: "run:\n\techo\nnonsense\n", line: 3},
+		{name: "missing endif", src: "ifdef A\nrun:\n", line: 1},
+		{name: "stray endif", src: "run:\nendif\n", line: 2},
+		{name: "missing endef", src: "define A\nfoo\n", line: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.src))
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Parse() error = %v, want *ParseError", err)
+			}
+			if perr.Pos.Line != tt.line {
+				t.Errorf("error on line %d, want %d: %v", perr.Pos.Line, tt.line, err)
+			}
+		})
+	}
+}
+
+func TestParseFile_Include(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Makefile":     "include common.mk\n-include missing.mk $(DYNAMIC)\nrun:\n\techo\n",
+		"common.mk":    "include Makefile\nlint:\n\techo lint\n",
+		"unrelated.mk": "unrelated:\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := ParseFile(filepath.Join(dir, "Makefile"))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	want := []string{"lint", "run"}
+	if got := f.Targets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Targets() = %q, want %q", got, want)
+	}
+}
+
+func TestRemovePrerequisites(t *testing.T) {
+	src := "a: b //x:y \\\n\tc | //x:z\n\techo a\nb: ; echo b\n"
+	got, changed, err := RemovePrerequisites(src, func(p string) bool {
+		return strings.HasPrefix(p, "//")
+	})
+	if err != nil {
+		t.Fatalf("RemovePrerequisites() error = %v", err)
+	}
+	want := "a: b c\n\n\techo a\nb: ; echo b\n"
+	if !changed || got != want {
+		t.Errorf("RemovePrerequisites() = %q, %v, want %q, true", got, changed, want)
+	}
+}
@@ -0,0 +1,210 @@
+// Package picker is a minimal interactive list picker for the terminal: type
+// to filter, move with the arrow keys, enter to pick and escape to cancel.
+package picker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrCancelled is returned when nothing was picked.
+var ErrCancelled = errors.New("cancelled")
+
+// maxRows is the number of items shown at once.
+const maxRows = 10
+
+// Item is a single entry in the list.
+type Item struct {
+	Label       string
+	Description string
+}
+
+// Filter returns the items that match the query, best match first.
+type Filter func(query string) []Item
+
+// Picker holds the state of the list while picking.
+type Picker struct {
+	filter   Filter
+	query    []rune
+	items    []Item
+	selected int
+	// width is the width of the terminal, longer lines are cut so that they
+	// don't wrap. Zero means unknown.
+	width int
+}
+
+// New returns a picker that starts with the query.
+func New(query string, filter Filter) *Picker {
+	p := &Picker{filter: filter, query: []rune(query)}
+	p.items = filter(query)
+	return p
+}
+
+// Key codes read from the terminal.
+const (
+	keyCtrlC     = 3
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEnter     = '\r'
+	keyNewline   = '\n'
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// HandleInput updates the picker with the bytes of a single read from the
+// terminal. It returns the picked item once enter is pressed, or
+// ErrCancelled if escape or ctrl-c was pressed.
+func (p *Picker) HandleInput(b []byte) (*Item, error) {
+	for len(b) > 0 {
+		switch {
+		case len(b) >= 3 && b[0] == keyEscape && b[1] == '[':
+			// arrow keys
+			switch b[2] {
+			case 'A':
+				p.move(-1)
+			case 'B':
+				p.move(1)
+			}
+			b = b[3:]
+			continue
+		case b[0] == keyEscape, b[0] == keyCtrlC:
+			return nil, ErrCancelled
+		case b[0] == keyEnter, b[0] == keyNewline:
+			if len(p.items) == 0 {
+				b = b[1:]
+				continue
+			}
+			item := p.items[p.selected]
+			return &item, nil
+		case b[0] == keyCtrlP:
+			p.move(-1)
+		case b[0] == keyCtrlN:
+			p.move(1)
+		case b[0] == keyBackspace, b[0] == keyCtrlH:
+			if len(p.query) > 0 {
+				p.setQuery(p.query[:len(p.query)-1])
+			}
+		case b[0] == keyCtrlU:
+			p.setQuery(nil)
+		case b[0] >= ' ':
+			r, size := utf8.DecodeRune(b)
+			p.setQuery(append(p.query, r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return nil, nil
+}
+
+func (p *Picker) move(delta int) {
+	p.selected += delta
+	if p.selected >= len(p.items) {
+		p.selected = len(p.items) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+func (p *Picker) setQuery(query []rune) {
+	p.query = query
+	p.items = p.filter(string(query))
+	p.selected = 0
+}
+
+// Render draws the prompt and the visible items, replacing what was drawn
+// last time. The cursor is left at the end of the prompt.
+func (p *Picker) Render(w io.Writer) {
+	var b strings.Builder
+	// back to the prompt line and clear everything below it
+	b.WriteString("\r\x1b[J")
+	fmt.Fprintf(&b, "> %s", string(p.query))
+
+	// scroll so the selected item is visible
+	first := 0
+	if p.selected >= maxRows {
+		first = p.selected - maxRows + 1
+	}
+	last := first + maxRows
+	if last > len(p.items) {
+		last = len(p.items)
+	}
+	for i := first; i < last; i++ {
+		line := p.items[i].Label
+		if p.items[i].Description != "" {
+			line += "  " + p.items[i].Description
+		}
+		if r := []rune(line); p.width > 0 && len(r) >= p.width {
+			line = string(r[:p.width-1])
+		}
+		if i == p.selected {
+			// reverse video
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString("\r\n" + line)
+	}
+	if last > first {
+		fmt.Fprintf(&b, "\x1b[%dA", last-first)
+	}
+	// move to the end of the prompt
+	fmt.Fprintf(&b, "\r\x1b[%dC", 2+len(p.query))
+	io.WriteString(w, b.String())
+}
+
+// Clear removes the picker from the terminal.
+func (p *Picker) Clear(w io.Writer) {
+	io.WriteString(w, "\r\x1b[J")
+}
+
+// Run shows the picker on the terminal until an item is picked or it is
+// cancelled. The terminal is put into raw mode with stty while picking.
+func Run(query string, filter Filter) (*Item, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open terminal: %w", err)
+	}
+	defer tty.Close()
+
+	state, err := stty(tty, "-g")
+	if err != nil {
+		return nil, fmt.Errorf("save terminal state: %w", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("set terminal to raw mode: %w", err)
+	}
+	defer stty(tty, strings.TrimSpace(state))
+
+	p := New(query, filter)
+	if size, err := stty(tty, "size"); err == nil {
+		// rows and columns
+		fmt.Sscan(size, new(int), &p.width)
+	}
+	defer p.Clear(tty)
+	buf := make([]byte, 64)
+	for {
+		p.Render(tty)
+		n, err := tty.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		item, err := p.HandleInput(buf[:n])
+		if item != nil || err != nil {
+			return item, err
+		}
+	}
+}
+
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,69 @@
+package picker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func filterPrefix(items ...string) Filter {
+	return func(query string) []Item {
+		var matches []Item
+		for _, i := range items {
+			if strings.HasPrefix(i, query) {
+				matches = append(matches, Item{Label: i})
+			}
+		}
+		return matches
+	}
+}
+
+func TestPicker_HandleInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		input   []string
+		want    string
+		wantErr error
+	}{
+		{name: "enter picks the first match", input: []string{"\r"}, want: "//a:build"},
+		{name: "type to filter", input: []string{"//b", "\r"}, want: "//b:test"},
+		{name: "initial query", query: "//b", input: []string{"\r"}, want: "//b:test"},
+		{name: "arrow keys", input: []string{"\x1b[B", "\x1b[B", "\x1b[A", "\r"}, want: "//a:test"},
+		{name: "ctrl-n and ctrl-p", input: []string{"\x0e\x0e\x0e\x0e\x10\r"}, want: "//a:test"},
+		{name: "down stops at the last match", query: "//a", input: []string{"\x1b[B\x1b[B\x1b[B", "\r"}, want: "//a:test"},
+		{name: "backspace", query: "//c", input: []string{"\x7fb", "\r"}, want: "//b:test"},
+		{name: "enter without matches does nothing", query: "//c", input: []string{"\r", "\x15", "\r"}, want: "//a:build"},
+		{name: "escape cancels", input: []string{"\x1b"}, wantErr: ErrCancelled},
+		{name: "ctrl-c cancels", input: []string{"\x03"}, wantErr: ErrCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.query, filterPrefix("//a:build", "//a:test", "//b:test"))
+			for _, in := range tt.input {
+				item, err := p.HandleInput([]byte(in))
+				if err != nil || item != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("HandleInput() error = %v, want %v", err, tt.wantErr)
+					}
+					if item != nil && item.Label != tt.want {
+						t.Errorf("HandleInput() = %s, want %s", item.Label, tt.want)
+					}
+					return
+				}
+			}
+			t.Fatalf("nothing was picked")
+		})
+	}
+}
+
+func TestPicker_Render(t *testing.T) {
+	p := New("//a", filterPrefix("//a:build", "//a:test", "//b:test"))
+	p.HandleInput([]byte("\x1b[B"))
+	var b strings.Builder
+	p.Render(&b)
+	want := "\r\x1b[J> //a\r\n//a:build\r\n\x1b[7m//a:test\x1b[0m\x1b[2A\r\x1b[5C"
+	if b.String() != want {
+		t.Errorf("Render() = %q, want %q", b.String(), want)
+	}
+}
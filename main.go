@@ -14,6 +14,14 @@ import (
 
 var workspacePath = flag.String("w", "", "path to workspace")
 var help = flag.Bool("h", false, "print help")
+var jobs = flag.Int("j", 1, "number of targets to run in parallel")
+var output = flag.String("output", mmake.OutputText, "output format: text or json")
+var dryRun bool
+
+func init() {
+	flag.BoolVar(&dryRun, "n", false, "print how targets would be run without running them")
+	flag.BoolVar(&dryRun, "dry-run", false, "same as -n")
+}
 
 func main() {
 	ctx := context.Background()
@@ -28,9 +36,20 @@ func main() {
 		return
 	}
 
-	mm := mmake.New()
+	mm := mmake.New(mmake.WithJobs(*jobs), mmake.WithOutput(*output), mmake.WithDryRun(dryRun), mmake.WithFlags(flag.CommandLine))
 
-	if err := mm.Run(ctx, *workspacePath, os.Args...); err != nil {
+	// the flags have been consumed, so pass the program name and the remaining args
+	args := append([]string{os.Args[0]}, flag.Args()...)
+	if err := mm.Run(ctx, *workspacePath, args...); err != nil {
+		var failedErr *workspace.ErrTargetsFailed
+		if errors.As(err, &failedErr) {
+			// in json mode the failures are part of the run output
+			if *output != mmake.OutputJSON {
+				mm.PrintError(err)
+			}
+			os.Exit(1)
+			return
+		}
 		var cmdErr *workspace.ErrCommand
 		if errors.As(err, &cmdErr) {
 			// if the error is a command error, then we want to exit with the exit code
@@ -43,7 +62,8 @@ func main() {
 			os.Exit(1)
 			return
 		}
-		fmt.Println("error:", err)
+		mm.PrintError(err)
+		os.Exit(1)
 	}
 }
 
@@ -54,10 +74,16 @@ func printUsage() {
 
 	fmt.Fprintf(os.Stderr, "\nCommands:\n")
 	fmt.Fprintf(os.Stderr, "  init\t\tInitialize a new workspace\n")
-	fmt.Fprintf(os.Stderr, "  completion\tPrint the completion script\n")
+	fmt.Fprintf(os.Stderr, "  completion [bash|zsh|fish]\tPrint the completion script, detecting the shell from $SHELL\n")
 	fmt.Fprintf(os.Stderr, "  clean\tRemove the package's build artifacts folder\n")
 	fmt.Fprintf(os.Stderr, "  info\tRetrieve information about target\n")
 	fmt.Fprintf(os.Stderr, "  vars\tPrint all the vars available to a script\n")
-	fmt.Fprintf(os.Stderr, "  //[path]:[target]\tRun a specific target\n")
+	fmt.Fprintf(os.Stderr, "  list, ls [-t] [//prefix]\tList packages and optionally their targets\n")
+	fmt.Fprintf(os.Stderr, "  affected [-since ref] [-run target] [path...]\tList or run the packages affected by changes\n")
+	fmt.Fprintf(os.Stderr, "  query [-format labels|table|json] '<expr>'\tFind targets matching the expression\n")
+	fmt.Fprintf(os.Stderr, "  find [-i] [-n limit] [words...]\tFuzzy find targets, or pick one to run with -i\n")
+	fmt.Fprintf(os.Stderr, "  watch [-interval d] [-debounce d] //[path]:[target]...\tRun targets again when their packages change\n")
+	fmt.Fprintf(os.Stderr, "  //[path]:[target]... [VAR=value] [make flags]\tRun one or more targets\n")
+	fmt.Fprintf(os.Stderr, "  [path]:[target]...\tRun targets relative to the current directory's package\n")
 	fmt.Fprintf(os.Stderr, "\n")
 }
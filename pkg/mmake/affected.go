@@ -0,0 +1,64 @@
+package mmake
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// Affected prints the packages affected by the changed paths, or runs a
+// target in each of them.
+//
+//	mmake affected [-since ref] [-run target] [path...]
+func (m *MMake) Affected(ctx context.Context, ws *workspace.Workspace, args []string) error {
+	fs := flag.NewFlagSet("affected", flag.ContinueOnError)
+	since := fs.String("since", "", "git ref to diff against to find the changed paths")
+	run := fs.String("run", "", "target to run in every affected package that defines it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	changed := fs.Args()
+	if *since != "" {
+		files, err := ws.ChangedFiles(ctx, *since)
+		if err != nil {
+			return err
+		}
+		changed = append(changed, files...)
+	} else if len(changed) == 0 {
+		return fmt.Errorf("affected requires either -since or a list of changed paths")
+	}
+
+	qu := workspace.NewQuery(ws, workspace.RootLabel)
+	if err := qu.Update(ctx, 0); err != nil {
+		return err
+	}
+	affected, err := qu.AffectedPackages(ctx, changed)
+	if err != nil {
+		return err
+	}
+
+	if *run != "" {
+		var targets []string
+		for _, a := range affected {
+			if bf := qu.GetFileByLabel(a.Label); bf != nil && bf.HasTarget(*run) {
+				targets = append(targets, workspace.TargetLabel(a.Label, *run))
+			}
+		}
+		if len(targets) == 0 {
+			fmt.Fprintf(m.stderr, "no affected packages define %s\n", *run)
+			return nil
+		}
+		return m.runTargets(ctx, ws, targets, nil)
+	}
+
+	if m.output == OutputJSON {
+		return writeJSON(m.stdout, affected)
+	}
+	for _, a := range affected {
+		fmt.Fprintln(m.stdout, a.Label)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package mmake
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aakarim/mmake/pkg/mmake/completion"
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// Complete prints the completions for the last of the words after mmake,
+// one per line with the description after a tab. Labels are only completed
+// inside a workspace, either the one given with -w in words or the one
+// containing inputPath.
+func (m *MMake) Complete(ctx context.Context, inputPath string, words []string) error {
+	for i := 0; i+1 < len(words); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(words[i], "-"), "=")
+		if !strings.HasPrefix(words[i], "-") || name != "w" {
+			continue
+		}
+		if !hasValue {
+			// the value is the next word, unless it is being completed
+			if i+2 >= len(words) {
+				break
+			}
+			i++
+			value = words[i]
+		}
+		inputPath = value
+	}
+
+	var ws *workspace.Workspace
+	if workspacePath, err := workspace.FindWorkspaceFile(ctx, inputPath); err == nil {
+		cfg, err := workspace.LoadConfig(workspacePath)
+		if err != nil {
+			return fmt.Errorf("load workspace config: %w", err)
+		}
+		ws = workspace.NewWithConfig(filepath.Dir(workspacePath), cfg)
+	}
+
+	c := completion.New(ws)
+	c.SetFlags(m.flags)
+	candidates, err := c.Complete(ctx, words)
+	if err != nil {
+		return err
+	}
+	if m.output == OutputJSON {
+		if candidates == nil {
+			candidates = []completion.Candidate{}
+		}
+		return writeJSON(m.stdout, candidates)
+	}
+	for _, c := range candidates {
+		if c.Description != "" {
+			fmt.Fprintf(m.stdout, "%s\t%s\n", c.Value, c.Description)
+		} else {
+			fmt.Fprintln(m.stdout, c.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package completion
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// CompleteCommand is the hidden command that the completion scripts call
+// with the words after mmake, ending with the word being completed.
+const CompleteCommand = "__complete"
+
+// importSeparator separates the target from the command to import.
+const importSeparator = "--"
+
+// labelCommands are the commands that take a label as their argument.
+var labelCommands = map[string]bool{"clean": true, "info": true, "list": true, "ls": true, "watch": true}
+
+// labelVerbs are the commands that can follow a label.
+var labelVerbs = []string{"info", "clean"}
+
+// Candidate is a single completion.
+type Candidate struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// SetFlags sets the global flags of mmake that are completed before the command.
+func (c *Completion) SetFlags(flags *flag.FlagSet) {
+	c.flags = flags
+}
+
+// Complete returns the candidates for the last word in words, which are the
+// words after mmake. The last word is empty if a new word is being started.
+func (c *Completion) Complete(ctx context.Context, words []string) ([]Candidate, error) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+
+	// find the positional words, skipping the global flags and their values
+	var positional []string
+	var prevFlag string
+	before := words[:len(words)-1]
+	for i := 0; i < len(before); i++ {
+		w := before[i]
+		if len(positional) > 0 || !strings.HasPrefix(w, "-") || w == importSeparator {
+			positional = append(positional, w)
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if hasValue || !c.takesValue(name) {
+			continue
+		}
+		if i == len(before)-1 {
+			// the word being completed is the value of the flag
+			prevFlag = name
+		}
+		i++
+	}
+
+	switch {
+	case prevFlag == "w":
+		return completePath(cur, true), nil
+	case prevFlag == "output":
+		return filter([]Candidate{{Value: "text"}, {Value: "json"}}, cur), nil
+	case prevFlag != "":
+		return nil, nil
+	case len(positional) == 0 && strings.HasPrefix(cur, "-"):
+		return filter(c.flagCandidates(), cur), nil
+	}
+
+	for i, w := range positional {
+		if w == importSeparator && i > 0 {
+			return completePath(cur, false), nil
+		}
+	}
+
+	if len(positional) == 0 {
+		if strings.HasPrefix(cur, workspace.RootLabel) {
+			return c.completeLabels(ctx, cur)
+		}
+		var candidates []Candidate
+		for _, cmd := range Commands {
+			candidates = append(candidates, Candidate{Value: cmd.Name, Description: cmd.Description})
+		}
+		return filter(candidates, cur), nil
+	}
+
+	first := positional[0]
+	switch {
+	case strings.HasPrefix(first, workspace.RootLabel):
+		// more labels, a verb or the command to import
+		for _, w := range positional {
+			if !strings.HasPrefix(w, workspace.RootLabel) {
+				return nil, nil
+			}
+		}
+		if strings.HasPrefix(cur, workspace.RootLabel) {
+			return c.completeLabels(ctx, cur)
+		}
+		var candidates []Candidate
+		for _, v := range labelVerbs {
+			candidates = append(candidates, Candidate{Value: v, Description: commandDescription(v)})
+		}
+		candidates = append(candidates, Candidate{Value: importSeparator, Description: "Import the command that follows as the target"})
+		return filter(candidates, cur), nil
+	case labelCommands[first] && len(args(positional[1:])) == 0:
+		if cur == "" {
+			cur = workspace.RootLabel
+		}
+		if strings.HasPrefix(cur, workspace.RootLabel) {
+			return c.completeLabels(ctx, cur)
+		}
+	case first == "completion" && len(positional) == 1:
+		var candidates []Candidate
+		for _, s := range Shells {
+			candidates = append(candidates, Candidate{Value: s})
+		}
+		return filter(candidates, cur), nil
+	}
+	return nil, nil
+}
+
+// completeLabels completes a label prefix to packages and targets.
+func (c *Completion) completeLabels(ctx context.Context, prefix string) ([]Candidate, error) {
+	if c.workspace == nil {
+		return nil, nil
+	}
+	return Labels(ctx, c.workspace, prefix)
+}
+
+// Labels completes a label prefix to packages and targets. Packages are
+// described by the comment at the top of their Makefile and targets by the
+// first line of the comment at the start of their recipe.
+func Labels(ctx context.Context, ws *workspace.Workspace, prefix string) ([]Candidate, error) {
+	qu := workspace.NewQuery(ws, prefix)
+	if err := qu.Update(ctx, 2); err != nil {
+		return nil, err
+	}
+	out, err := qu.GenComp(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []Candidate
+	for _, l := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if l != "" {
+			candidates = append(candidates, Candidate{Value: l, Description: describeLabel(qu, l)})
+		}
+	}
+	return candidates, nil
+}
+
+// describeLabel returns the description of a package or target label.
+func describeLabel(qu *workspace.Query, label string) string {
+	pkg, target, isTarget := strings.Cut(label, ":")
+	f := qu.GetFileByLabel(workspace.Label(pkg))
+	if f == nil {
+		return ""
+	}
+	desc := f.Description
+	if isTarget {
+		desc = f.TargetDescriptions[target]
+	}
+	firstLine, _, _ := strings.Cut(desc, "\n")
+	return firstLine
+}
+
+// flagCandidates returns the global flags.
+func (c *Completion) flagCandidates() []Candidate {
+	if c.flags == nil {
+		return nil
+	}
+	var candidates []Candidate
+	c.flags.VisitAll(func(f *flag.Flag) {
+		candidates = append(candidates, Candidate{Value: "-" + f.Name, Description: f.Usage})
+	})
+	return candidates
+}
+
+// takesValue returns true if the flag is followed by a value.
+func (c *Completion) takesValue(name string) bool {
+	if c.flags == nil {
+		return false
+	}
+	f := c.flags.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// completePath completes a file path relative to the working directory.
+// Directories end with a '/' so that completion can continue into them.
+func completePath(prefix string, dirsOnly bool) []Candidate {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var candidates []Candidate
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			candidates = append(candidates, Candidate{Value: dir + name + "/"})
+		case !dirsOnly:
+			candidates = append(candidates, Candidate{Value: dir + name})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Value < candidates[j].Value
+	})
+	return candidates
+}
+
+// filter returns the candidates that start with prefix.
+func filter(candidates []Candidate, prefix string) []Candidate {
+	var filtered []Candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(c.Value, prefix) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// args returns the words that are not flags.
+func args(words []string) []string {
+	var a []string
+	for _, w := range words {
+		if !strings.HasPrefix(w, "-") {
+			a = append(a, w)
+		}
+	}
+	return a
+}
+
+func commandDescription(name string) string {
+	for _, c := range Commands {
+		if c.Name == name {
+			return c.Description
+		}
+	}
+	return ""
+}
@@ -2,13 +2,52 @@ package completion
 
 import (
 	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 	"text/template"
 
 	"github.com/aakarim/mmake/pkg/mmake/workspace"
 )
 
+// Shells that completion scripts can be printed for.
+const (
+	Bash = "bash"
+	Zsh  = "zsh"
+	Fish = "fish"
+)
+
+// Shells are the supported shells.
+var Shells = []string{Bash, Zsh, Fish}
+
+// Command is a subcommand of mmake.
+type Command struct {
+	Name        string
+	Description string
+}
+
+// Commands are the subcommands that are completed after mmake.
+var Commands = []Command{
+	{Name: "init", Description: "Initialize a new workspace"},
+	{Name: "completion", Description: "Print the completion script"},
+	{Name: "clean", Description: "Remove the package's build artifacts folder"},
+	{Name: "info", Description: "Retrieve information about target"},
+	{Name: "vars", Description: "Print all the vars available to a script"},
+	{Name: "list", Description: "List packages and optionally their targets"},
+	{Name: "ls", Description: "List packages and optionally their targets"},
+	{Name: "affected", Description: "List or run the packages affected by changes"},
+	{Name: "query", Description: "Find targets matching the expression"},
+	{Name: "find", Description: "Fuzzy find targets, or pick one to run with -i"},
+	{Name: "watch", Description: "Run targets again when their packages change"},
+}
+
+// Completion completes the words of an mmake command line.
 type Completion struct {
+	// workspace is nil outside of a workspace, then only commands and flags
+	// are completed
 	workspace *workspace.Workspace
+	flags     *flag.FlagSet
 }
 
 func New(workspace *workspace.Workspace) *Completion {
@@ -17,13 +56,29 @@ func New(workspace *workspace.Workspace) *Completion {
 	}
 }
 
-// GetCompletionScript returns the completion script for the current shell
-func GetCompletionScript() string {
-	template := template.Must(template.New("completion").Parse(completionScript))
+// DetectShell returns the shell named by $SHELL, or an error if it isn't
+// one of the supported shells.
+func DetectShell() (string, error) {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	for _, s := range Shells {
+		if shell == s {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("cannot detect the shell from $SHELL=%q, use one of %v", os.Getenv("SHELL"), Shells)
+}
+
+// GetCompletionScript returns the completion script for the shell
+func GetCompletionScript(shell string) (string, error) {
+	src, err := scripts.ReadFile("completion." + shell + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("no completion script for %q, use one of %v", shell, Shells)
+	}
+	template := template.Must(template.New("completion").Parse(string(src)))
 	bufStr := bytes.NewBufferString("")
-	if err := template.Execute(bufStr, templateVars{}); err != nil {
-		panic(err)
+	if err := template.Execute(bufStr, templateVars{CompleteCommand: CompleteCommand}); err != nil {
+		return "", err
 	}
 
-	return bufStr.String()
+	return bufStr.String(), nil
 }
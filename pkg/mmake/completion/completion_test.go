@@ -0,0 +1,147 @@
+package completion
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+func TestGetCompletionScript(t *testing.T) {
+	tests := []struct {
+		shell   string
+		want    string
+		wantErr bool
+	}{
+		{shell: Bash, want: "complete -F _mmake__complete mmake"},
+		{shell: Zsh, want: "compdef _mmake mmake"},
+		{shell: Fish, want: "complete -c mmake -f -a '(__mmake_complete)'"},
+		{shell: "tcsh", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			got, err := GetCompletionScript(tt.shell)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCompletionScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("GetCompletionScript() = %s, want it to contain %s", got, tt.want)
+			}
+			if !tt.wantErr && !strings.Contains(got, "mmake "+CompleteCommand) {
+				t.Errorf("GetCompletionScript() doesn't call mmake %s", CompleteCommand)
+			}
+		})
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	t.Setenv("SHELL", "/usr/local/bin/fish")
+	if got, err := DetectShell(); err != nil || got != Fish {
+		t.Errorf("DetectShell() = %q, %v, want %q", got, err, Fish)
+	}
+	t.Setenv("SHELL", "/bin/tcsh")
+	if _, err := DetectShell(); err == nil {
+		t.Errorf("DetectShell() with an unsupported shell should fail")
+	}
+}
+
+func TestCompletion_Complete(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		workspace.WorkspaceFile:  "",
+		"Makefile":               "hello:\n",
+		"services/api/Makefile":  "build:\ndeploy:\n",
+		"services/auth/Makefile": "build:\n",
+		"scripts/run.sh":         "",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flags := flag.NewFlagSet("mmake", flag.ContinueOnError)
+	flags.String("w", "", "path to workspace")
+	flags.Bool("h", false, "print help")
+	flags.String("output", "text", "output format")
+
+	c := New(workspace.New(root))
+	c.SetFlags(flags)
+
+	tests := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{name: "commands", words: []string{"cl"}, want: []string{"clean"}},
+		{name: "flags", words: []string{"-"}, want: []string{"-h", "-output", "-w"}},
+		{name: "flag value", words: []string{"-output", "j"}, want: []string{"json"}},
+		{name: "commands after flags", words: []string{"-h", "-w", root, "in"}, want: []string{"init", "info"}},
+		{name: "workspace directory", words: []string{"-w", root + "/s"}, want: []string{root + "/scripts/", root + "/services/"}},
+		{name: "labels", words: []string{"//services/a"}, want: []string{"//services/api", "//services/auth"}},
+		{name: "targets", words: []string{"//services/api:d"}, want: []string{"//services/api:deploy"}},
+		{name: "labels after clean", words: []string{"clean", ""}, want: []string{"//", "//services/"}},
+		{name: "labels after info", words: []string{"info", "//services/auth:"}, want: []string{"//services/auth:build"}},
+		{name: "nothing after the label of clean", words: []string{"clean", "//", ""}},
+		{name: "verbs after a label", words: []string{"//:hello", ""}, want: []string{"info", "clean", "--"}},
+		{name: "more labels", words: []string{"//:hello", "//services/api:b"}, want: []string{"//services/api:build"}},
+		{name: "files after --", words: []string{"//:hello", "--", "sh", root + "/scripts/r"}, want: []string{root + "/scripts/run.sh"}},
+		{name: "shells", words: []string{"completion", "z"}, want: []string{"zsh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates, err := c.Complete(context.Background(), tt.words)
+			if err != nil {
+				t.Fatalf("Completion.Complete() error = %v", err)
+			}
+			var got []string
+			for _, c := range candidates {
+				got = append(got, c.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Completion.Complete(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabels_Descriptions(t *testing.T) {
+	root := t.TempDir()
+	src := "# API service commands\ndeploy:\n\t# Deploy the API service\n\t# to production\n\techo deploy\nbuild:\n\techo build\n"
+	if err := os.MkdirAll(filepath.Join(root, "api"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "api", "Makefile"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws := workspace.New(root)
+
+	tests := []struct {
+		prefix string
+		want   []Candidate
+	}{
+		{prefix: "//a", want: []Candidate{{Value: "//api", Description: "API service commands"}}},
+		{prefix: "//api:", want: []Candidate{
+			{Value: "//api:deploy", Description: "Deploy the API service"},
+			{Value: "//api:build"},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := Labels(context.Background(), ws, tt.prefix)
+		if err != nil {
+			t.Fatalf("Labels() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Labels(%q) = %+v, want %+v", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package completion
 
 import (
-	_ "embed"
+	"embed"
 )
 
-//go:embed completion.bash.tmpl
-var completionScript string
+//go:embed completion.*.tmpl
+var scripts embed.FS
 
 type templateVars struct {
+	// CompleteCommand is the command that prints the completions
+	CompleteCommand string
 }
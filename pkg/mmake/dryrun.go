@@ -0,0 +1,78 @@
+package mmake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// dryRunTargets prints how the targets and their dependencies would be run
+// instead of running them.
+func (m *MMake) dryRunTargets(ctx context.Context, ws *workspace.Workspace, targets []string, makeArgs []string) error {
+	runs, err := ws.DryRunTargets(ctx, makeArgs, targets...)
+	if err != nil {
+		return err
+	}
+	if m.output == OutputJSON {
+		return writeJSON(m.stdout, runs)
+	}
+	for i, run := range runs {
+		if i > 0 {
+			fmt.Fprintln(m.stdout)
+		}
+		fmt.Fprintf(m.stdout, "# %s\n", run.Label)
+		if run.Image != "" {
+			fmt.Fprintf(m.stdout, "# in a container from %s, with the workspace mounted at /workspace\n", run.Image)
+		}
+		fmt.Fprintf(m.stdout, "cd %s\n", shellQuote(run.Dir))
+		fmt.Fprintln(m.stdout, "env \\")
+		for _, e := range run.Env {
+			fmt.Fprintf(m.stdout, "  %s \\\n", shellQuote(e))
+		}
+		var command []string
+		for _, a := range run.Command {
+			command = append(command, shellQuote(a))
+		}
+		if run.Stdin == "" {
+			fmt.Fprintf(m.stdout, "  %s\n", strings.Join(command, " "))
+		} else {
+			// make reads the Makefile from a heredoc
+			delim := heredocDelimiter(run.Stdin)
+			fmt.Fprintf(m.stdout, "  %s <<'%s'\n%s", strings.Join(command, " "), delim, run.Stdin)
+			if !strings.HasSuffix(run.Stdin, "\n") {
+				fmt.Fprintln(m.stdout)
+			}
+			fmt.Fprintln(m.stdout, delim)
+		}
+		if run.Recipe == "" {
+			continue
+		}
+		fmt.Fprintln(m.stdout, "# make -n:")
+		for _, l := range strings.Split(strings.TrimSuffix(run.Recipe, "\n"), "\n") {
+			if l != "" {
+				fmt.Fprintf(m.stdout, "#   %s\n", l)
+			}
+		}
+	}
+	return nil
+}
+
+// heredocDelimiter returns a heredoc delimiter that isn't a line of s.
+func heredocDelimiter(s string) string {
+	delim := "MAKEFILE"
+	for strings.Contains("\n"+s+"\n", "\n"+delim+"\n") {
+		delim += "_"
+	}
+	return delim
+}
+
+// shellQuote quotes s for a POSIX shell if it contains anything other than
+// characters that are safe unquoted.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=/.,:@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,66 @@
+package mmake
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aakarim/mmake/internal/picker"
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// Find prints the targets whose labels fuzzy match the words, best match
+// first. With -i it shows an interactive picker and runs the picked target.
+//
+//	mmake find [-i] [-n limit] [words...]
+func (m *MMake) Find(ctx context.Context, ws *workspace.Workspace, args []string) error {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	interactive := fs.Bool("i", false, "pick a target interactively and run it")
+	limit := fs.Int("n", 0, "print at most n targets, 0 prints every match")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pattern := strings.Join(fs.Args(), " ")
+	if pattern == "" && !*interactive {
+		return fmt.Errorf("find requires a pattern, or -i to pick interactively")
+	}
+
+	qu := workspace.NewQuery(ws, workspace.RootLabel)
+	if err := qu.Update(ctx, 0); err != nil {
+		return err
+	}
+
+	if *interactive {
+		item, err := picker.Run(pattern, func(query string) []picker.Item {
+			var items []picker.Item
+			for _, match := range qu.Find(query) {
+				items = append(items, picker.Item{Label: match.Label, Description: match.Description})
+			}
+			return items
+		})
+		if errors.Is(err, picker.ErrCancelled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return m.runTargets(ctx, ws, []string{item.Label}, nil)
+	}
+
+	matches := qu.Find(pattern)
+	if *limit > 0 && len(matches) > *limit {
+		matches = matches[:*limit]
+	}
+	if m.output == OutputJSON {
+		if matches == nil {
+			matches = []*workspace.FuzzyMatch{}
+		}
+		return writeJSON(m.stdout, matches)
+	}
+	for _, match := range matches {
+		fmt.Fprintln(m.stdout, match.Label)
+	}
+	return nil
+}
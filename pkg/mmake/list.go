@@ -0,0 +1,108 @@
+package mmake
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// List prints the packages under the prefix with their descriptions.
+//
+//	mmake list [-t] [//prefix]
+func (m *MMake) List(ctx context.Context, ws *workspace.Workspace, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	withTargets := fs.Bool("t", false, "list the targets of each package")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	prefix := workspace.RootLabel
+	if fs.NArg() > 0 {
+		prefix = fs.Arg(0)
+	}
+
+	qu := workspace.NewQuery(ws, workspace.RootLabel)
+	if err := qu.Update(ctx, 0); err != nil {
+		return err
+	}
+	for _, err := range qu.Skipped() {
+		fmt.Fprintf(m.stderr, "mmake: %v, skipping it\n", err)
+	}
+	// the root prefix of QueryFilesByPrefix only returns the root package
+	files := qu.Files()
+	if prefix != workspace.RootLabel {
+		var err error
+		files, err = qu.QueryFilesByPrefix(ctx, prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	var targets []*workspace.TargetInfo
+	if *withTargets {
+		var err error
+		targets, err = qu.Targets(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.output == OutputJSON {
+		return writeJSON(m.stdout, packageOutputs(files, targets))
+	}
+	return printPackages(m.stdout, files, targets)
+}
+
+func packageOutputs(files []*workspace.BuildFile, targets []*workspace.TargetInfo) []*PackageOutput {
+	targetsByFile := groupTargetsByFile(targets)
+
+	out := make([]*PackageOutput, 0, len(files))
+	for _, f := range sortFiles(files) {
+		out = append(out, &PackageOutput{
+			Label:       f.Label,
+			Path:        f.Path,
+			Description: f.Description,
+			Targets:     targetsByFile[f.Path],
+		})
+	}
+	return out
+}
+
+func groupTargetsByFile(targets []*workspace.TargetInfo) map[string][]*workspace.TargetInfo {
+	targetsByFile := map[string][]*workspace.TargetInfo{}
+	for _, t := range targets {
+		targetsByFile[t.Path] = append(targetsByFile[t.Path], t)
+	}
+	return targetsByFile
+}
+
+// sortFiles returns a copy of the files sorted by label.
+func sortFiles(files []*workspace.BuildFile) []*workspace.BuildFile {
+	files = append([]*workspace.BuildFile{}, files...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Label < files[j].Label
+	})
+	return files
+}
+
+// printPackages prints the packages sorted by label, each followed by its
+// targets (if any) indented underneath.
+func printPackages(w io.Writer, files []*workspace.BuildFile, targets []*workspace.TargetInfo) error {
+	targetsByFile := groupTargetsByFile(targets)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, f := range sortFiles(files) {
+		fmt.Fprintf(tw, "%s\t%s\n", f.Label, f.Description)
+		for _, t := range targetsByFile[f.Path] {
+			// only the first line fits in a table
+			desc, _, _ := strings.Cut(t.Description, "\n")
+			fmt.Fprintf(tw, "  :%s\t%s\n", t.Name, desc)
+		}
+	}
+	return tw.Flush()
+}
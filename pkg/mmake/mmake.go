@@ -2,80 +2,218 @@ package mmake
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/aakarim/mmake/pkg/mmake/completion"
 	"github.com/aakarim/mmake/pkg/mmake/workspace"
 )
 
 type MMake struct {
+	// jobs is the number of targets that can run in parallel
+	jobs int
+	// output is the output mode, either OutputText or OutputJSON
+	output string
+	stdout io.Writer
+	stderr io.Writer
+	// flags are the global flags, used for completion
+	flags *flag.FlagSet
+	// dryRun prints how targets would be run instead of running them
+	dryRun bool
 }
 
-func New() *MMake {
-	return &MMake{}
+type Option func(*MMake)
+
+// WithJobs sets the number of targets that can run in parallel.
+func WithJobs(jobs int) Option {
+	return func(m *MMake) {
+		m.jobs = jobs
+	}
 }
 
-func (m *MMake) Run(ctx context.Context, inputPath string, args ...string) error {
-	var target string
-	var command string
+// WithFlags sets the global flags so that they can be completed.
+func WithFlags(flags *flag.FlagSet) Option {
+	return func(m *MMake) {
+		m.flags = flags
+	}
+}
 
-	// if args[1] starts with '//' then it's a target
-	if len(args) > 1 && args[1][:2] == "//" {
-		target = args[1]
-		if len(args) > 2 {
-			command = args[2]
-		} else {
-			command = "run"
+// WithDryRun prints how targets would be run instead of running them.
+func WithDryRun(dryRun bool) Option {
+	return func(m *MMake) {
+		m.dryRun = dryRun
+	}
+}
+
+// WithOutput sets the output mode, either OutputText or OutputJSON.
+func WithOutput(output string) Option {
+	return func(m *MMake) {
+		m.output = output
+	}
+}
+
+func New(opts ...Option) *MMake {
+	m := &MMake{jobs: 1, output: OutputText, stdout: os.Stdout, stderr: os.Stderr}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// commandLine is what the arguments ask mmake to do.
+type commandLine struct {
+	command string
+	// target is the first label, or the first argument of the command
+	target string
+	// targets are the labels at the start of the arguments
+	targets []string
+	// makeArgs are the variables and flags passed to make for the targets
+	makeArgs []string
+}
+
+// parseArgs splits the arguments, starting with the program name, into the
+// labels and what follows them: nothing or VAR=value overrides and make flags
+// to run the targets, -- to import a command, or another command. Without
+// labels the first argument is the command.
+func parseArgs(args []string) (*commandLine, error) {
+	c := &commandLine{}
+	// if args[1] is a label then it's a target, and so is every following
+	// argument that is a label
+	if len(args) > 1 && isLabel(args[1]) {
+		i := 1
+		for ; i < len(args) && isLabel(args[i]); i++ {
+			c.targets = append(c.targets, args[i])
+		}
+		c.target = c.targets[0]
+		switch {
+		case i == len(args):
+			c.command = "run"
+		case args[i] != importSeparator && (strings.HasPrefix(args[i], "-") || strings.Contains(args[i], "=")):
+			// VAR=value overrides and make flags
+			c.command = "run"
+			c.makeArgs = args[i:]
+			if err := workspace.CheckMakeArgs(c.makeArgs); err != nil {
+				return nil, err
+			}
+		default:
+			c.command = args[i]
 		}
 	}
 
-	if command == "" && len(args) > 1 {
-		command = args[1]
+	if c.command == "" && len(args) > 1 {
+		c.command = args[1]
 		if len(args) > 2 {
-			target = args[2]
+			c.target = args[2]
 		}
 	}
+	return c, nil
+}
+
+func (m *MMake) Run(ctx context.Context, inputPath string, args ...string) error {
+	c, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	target, targets, command, makeArgs := c.target, c.targets, c.command, c.makeArgs
 
 	if target == "" && command == "" {
 		return ErrNoCommand
 	}
 
+	if m.output != OutputText && m.output != OutputJSON {
+		return fmt.Errorf("unknown output mode %q", m.output)
+	}
+
 	if command == "completion" {
-		fmt.Println(completion.GetCompletionScript())
+		shell := target
+		if shell == "" {
+			var err error
+			if shell, err = completion.DetectShell(); err != nil {
+				return err
+			}
+		}
+		script, err := completion.GetCompletionScript(shell)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(m.stdout, script)
 		return nil
 	}
 
+	if command == completion.CompleteCommand {
+		return m.Complete(ctx, inputPath, args[2:])
+	}
+
 	if command == "init" {
 		if err := m.Init(ctx); err != nil {
 			panic(err)
 		}
+		if m.output == OutputJSON {
+			abs, err := filepath.Abs(workspace.WorkspaceFile)
+			if err != nil {
+				return err
+			}
+			return writeJSON(m.stdout, InitOutput{Workspace: abs})
+		}
 		return nil
 	}
 	workspacePath, err := workspace.FindWorkspaceFile(ctx, inputPath)
 	if err != nil {
 		return err
 	}
-	ws := workspace.New(filepath.Dir(workspacePath))
+	cfg, err := workspace.LoadConfig(workspacePath)
+	if err != nil {
+		return fmt.Errorf("load workspace config: %w", err)
+	}
+	ws := workspace.NewWithConfig(filepath.Dir(workspacePath), cfg)
+	ws.SetReadOnly(m.dryRun)
 
 	if err := ws.Init(ctx); err != nil {
 		return err
 	}
 
-	if target != "" && workspace.HasCommandToImport(args) {
-		if err := ws.Import(ctx, target, args); err != nil {
+	// resolve relative labels against the package of the working directory
+	if len(targets) > 0 || ((command == "clean" || command == "info") && target != "") {
+		wd, err := os.Getwd()
+		if err != nil {
 			return err
 		}
-		return nil
+		for i, t := range targets {
+			l, err := ws.ResolveLabel(t, wd)
+			if err != nil {
+				return err
+			}
+			targets[i] = l.String()
+		}
+		l, err := ws.ResolveLabel(target, wd)
+		if err != nil {
+			return err
+		}
+		target = l.String()
+	}
+
+	if command == importSeparator && workspace.HasCommandToImport(args) {
+		if m.dryRun {
+			return fmt.Errorf("a command can't be imported in a dry run")
+		}
+		if err := ws.ImportTarget(ctx, target, args); err != nil {
+			return err
+		}
+		return m.runTargets(ctx, ws, []string{target}, nil)
 	}
 
 	if command == "vars" {
-		fmt.Println("MM_ROOT = path to WORKSPACE.mmake")
-		fmt.Println("MM_PATH = path to package directory")
-		fmt.Println("MM_OUT_ROOT = path to output directory root")
-		fmt.Println("MM_OUT_PATH = path to package output directory")
-		fmt.Println("WS_ROOT = path to the root of the workspace (where the WORKSPACE.make file is located)")
+		if m.output == OutputJSON {
+			return writeJSON(m.stdout, vars)
+		}
+		for _, v := range vars {
+			fmt.Fprintf(m.stdout, "%s = %s\n", v.Name, v.Description)
+		}
 		return nil
 	}
 
@@ -83,6 +221,9 @@ func (m *MMake) Run(ctx context.Context, inputPath string, args ...string) error
 		if err := ws.Clean(ctx, target); err != nil {
 			return err
 		}
+		if m.output == OutputJSON {
+			return writeJSON(m.stdout, CleanOutput{Label: target})
+		}
 		return nil
 	}
 
@@ -91,44 +232,151 @@ func (m *MMake) Run(ctx context.Context, inputPath string, args ...string) error
 		if err != nil {
 			return err
 		}
-		fmt.Println(target, "info:")
-		fmt.Println(info)
+		if m.output == OutputJSON {
+			return writeJSON(m.stdout, InfoOutput{Label: target, Info: info})
+		}
+		fmt.Fprintln(m.stdout, target, "info:")
+		fmt.Fprintln(m.stdout, info)
 		return nil
 	}
 
+	if command == "list" || command == "ls" {
+		return m.List(ctx, ws, args[2:])
+	}
+
+	if command == "affected" {
+		return m.Affected(ctx, ws, args[2:])
+	}
+
+	if command == "query" {
+		return m.Query(ctx, ws, args[2:])
+	}
+
+	if command == "find" {
+		return m.Find(ctx, ws, args[2:])
+	}
+
+	if command == "watch" {
+		return m.Watch(ctx, ws, args[2:])
+	}
+
 	if command == "compgen" {
+		// with -d every label is followed by a tab and its description
+		describe := target == "-d"
 		prefix := target
+		if describe {
+			prefix = ""
+			if len(args) > 3 {
+				prefix = args[3]
+			}
+		}
+		if prefix == "" {
+			return fmt.Errorf("query required")
+		}
+
+		if describe {
+			candidates, err := completion.Labels(ctx, ws, prefix)
+			if err != nil {
+				return err
+			}
+			if m.output == OutputJSON {
+				if candidates == nil {
+					candidates = []completion.Candidate{}
+				}
+				return writeJSON(m.stdout, candidates)
+			}
+			for _, c := range candidates {
+				fmt.Fprintf(m.stdout, "%s\t%s\n", c.Value, c.Description)
+			}
+			return nil
+		}
+
 		qu := workspace.NewQuery(ws, prefix)
 		if err := qu.Update(ctx, 2); err != nil {
 			return err
 		}
 
-		if len(args) < 3 {
-			return fmt.Errorf("query required")
-		}
-
 		outputStr, err := qu.GenComp(ctx, prefix)
 		if err != nil {
 			return err
 		}
-		fmt.Print(outputStr)
+		if m.output == OutputJSON {
+			completions := strings.Split(strings.TrimSuffix(outputStr, "\n"), "\n")
+			if outputStr == "" {
+				completions = []string{}
+			}
+			return writeJSON(m.stdout, completions)
+		}
+		fmt.Fprint(m.stdout, outputStr)
 		return nil
 	}
 
 	if command == "run" || command == "" {
-		if err := ws.RunTarget(ctx, target); err != nil {
+		targets, err := workspace.ExpandPatterns(ctx, ws, targets)
+		if err != nil {
 			return err
 		}
-		return nil
+		if len(targets) == 0 {
+			return fmt.Errorf("no targets match %s", strings.Join(args[1:], " "))
+		}
+		return m.runTargets(ctx, ws, targets, makeArgs)
 	}
 
 	return ErrNoCommand
 }
 
+// isLabel returns true if the argument is a label rather than a command,
+// either absolute like //services/api:build or relative like :build.
+func isLabel(arg string) bool {
+	if strings.HasPrefix(arg, workspace.RootLabel) {
+		return true
+	}
+	return strings.Contains(arg, ":") && !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=")
+}
+
+// importSeparator separates the labels from the command to import.
+const importSeparator = "--"
+
+var vars = []VarOutput{
+	{"MM_ROOT", "path to WORKSPACE.mmake"},
+	{"MM_PATH", "path to package directory"},
+	{"MM_OUT_ROOT", "path to output directory root"},
+	{"MM_OUT_PATH", "path to package output directory"},
+	{"WS_ROOT", "path to the root of the workspace (where the WORKSPACE.make file is located)"},
+}
+
+// runTargets runs the targets, passing makeArgs to make, and, in json mode,
+// prints the results. The output of the targets goes to stderr in json mode.
+// In a dry run it prints how they would be run instead.
+func (m *MMake) runTargets(ctx context.Context, ws *workspace.Workspace, targets []string, makeArgs []string) error {
+	if m.dryRun {
+		return m.dryRunTargets(ctx, ws, targets, makeArgs)
+	}
+	opts := workspace.RunOptions{Jobs: m.jobs, MakeArgs: makeArgs}
+	if m.output == OutputJSON {
+		opts.Stdout = os.Stderr
+	}
+
+	start := time.Now()
+	results, err := ws.RunTargets(ctx, opts, targets...)
+	if m.output != OutputJSON || results == nil {
+		return err
+	}
+
+	out := RunOutput{Results: results, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		out.ExitCode = 1
+	}
+	if jsonErr := writeJSON(m.stdout, out); jsonErr != nil {
+		return jsonErr
+	}
+	return err
+}
+
 // Init creates a new WORKSPACE.mmake file in the current directory
 // TODO: move this into the workspace package
 func (m *MMake) Init(ctx context.Context) error {
-	_, err := os.Create("WORKSPACE.mmake")
+	_, err := os.Create(workspace.WorkspaceFile)
 	if err != nil {
 		return err
 	}
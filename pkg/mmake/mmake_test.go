@@ -0,0 +1,105 @@
+package mmake
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *commandLine
+		wantErr bool
+	}{
+		{
+			name: "no arguments",
+			args: []string{"mmake"},
+			want: &commandLine{},
+		},
+		{
+			name: "single character command",
+			args: []string{"mmake", "x"},
+			want: &commandLine{command: "x"},
+		},
+		{
+			name: "command with an argument",
+			args: []string{"mmake", "info", "//api:build"},
+			want: &commandLine{command: "info", target: "//api:build"},
+		},
+		{
+			name: "labels",
+			args: []string{"mmake", "//api:build", ":lint", "web:test"},
+			want: &commandLine{command: "run", target: "//api:build", targets: []string{"//api:build", ":lint", "web:test"}},
+		},
+		{
+			name: "variables and flags after the labels",
+			args: []string{"mmake", "//api:build", "ARGS=--fix", "-k", "-j", "4"},
+			want: &commandLine{
+				command:  "run",
+				target:   "//api:build",
+				targets:  []string{"//api:build"},
+				makeArgs: []string{"ARGS=--fix", "-k", "-j", "4"},
+			},
+		},
+		{
+			name: "a variable with a colon isn't a label",
+			args: []string{"mmake", "//api:build", "X=a:b"},
+			want: &commandLine{command: "run", target: "//api:build", targets: []string{"//api:build"}, makeArgs: []string{"X=a:b"}},
+		},
+		{
+			name: "import",
+			args: []string{"mmake", "//api:build", "--", "go", "build", "-o", "x=y"},
+			want: &commandLine{command: "--", target: "//api:build", targets: []string{"//api:build"}},
+		},
+		{
+			name: "command after the labels",
+			args: []string{"mmake", "//api:build", "watch"},
+			want: &commandLine{command: "watch", target: "//api:build", targets: []string{"//api:build"}},
+		},
+		{
+			name:    "-- after the variables",
+			args:    []string{"mmake", "//api:build", "X=1", "--", "echo"},
+			wantErr: true,
+		},
+		{
+			name:    "-f can't be passed",
+			args:    []string{"mmake", "//api:build", "-f", "other.mk"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsLabel(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{arg: "//api:build", want: true},
+		{arg: "//...", want: true},
+		{arg: ":x", want: true},
+		{arg: "a:b", want: true},
+		{arg: "X=a:b"},
+		{arg: "--opt=a:b"},
+		{arg: "-k"},
+		{arg: "list"},
+		{arg: "x"},
+		{arg: ""},
+	}
+	for _, tt := range tests {
+		if got := isLabel(tt.arg); got != tt.want {
+			t.Errorf("isLabel(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
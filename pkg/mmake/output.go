@@ -0,0 +1,84 @@
+package mmake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// Output modes for the global --output flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// The JSON documents printed by each command when the output mode is json.
+// Fields are only ever added to these types, never renamed or removed.
+// `mmake query` prints a list of workspace.TargetInfo and `mmake compgen`
+// prints a list of completions as strings, or a list of
+// completion.Candidate with -d, as does `mmake __complete`. A dry run prints
+// a list of workspace.DryRun.
+type (
+	// RunOutput is printed after running targets. The output of the targets
+	// themselves is written to stderr so that stdout only holds the document.
+	RunOutput struct {
+		Results []*workspace.TargetResult `json:"results"`
+		// ExitCode is 0 if every target succeeded and 1 otherwise
+		ExitCode   int   `json:"exit_code"`
+		DurationMS int64 `json:"duration_ms"`
+	}
+
+	// InfoOutput is printed by `mmake //pkg:target info`.
+	InfoOutput struct {
+		Label string `json:"label"`
+		Info  string `json:"info"`
+	}
+
+	// VarOutput is printed for every variable by `mmake vars`.
+	VarOutput struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	// PackageOutput is printed for every package by `mmake list`.
+	PackageOutput struct {
+		Label       workspace.Label `json:"label"`
+		Path        string          `json:"path"`
+		Description string          `json:"description,omitempty"`
+		// Targets are only listed with `mmake list -t`
+		Targets []*workspace.TargetInfo `json:"targets,omitempty"`
+	}
+
+	// CleanOutput is printed by `mmake clean //pkg`.
+	CleanOutput struct {
+		Label string `json:"label"`
+	}
+
+	// InitOutput is printed by `mmake init`.
+	InitOutput struct {
+		Workspace string `json:"workspace"`
+	}
+
+	// ErrorOutput is printed when a command fails for any reason other than
+	// a target failing.
+	ErrorOutput struct {
+		Error string `json:"error"`
+	}
+)
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// PrintError prints an error in the output mode.
+func (m *MMake) PrintError(err error) {
+	if m.output == OutputJSON {
+		writeJSON(m.stdout, ErrorOutput{Error: err.Error()})
+		return
+	}
+	fmt.Fprintln(m.stdout, "error:", err)
+}
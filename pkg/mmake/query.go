@@ -0,0 +1,80 @@
+package mmake
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+const (
+	formatLabels = "labels"
+	formatTable  = "table"
+	formatJSON   = "json"
+)
+
+// Query prints the targets in the workspace that match the query expression.
+//
+//	mmake query [-format labels|table|json] '<expr>'
+func (m *MMake) Query(ctx context.Context, ws *workspace.Workspace, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	format := fs.String("format", "", "output format: labels, table or json (default labels, or json with --output=json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = formatLabels
+		if m.output == OutputJSON {
+			*format = formatJSON
+		}
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("query takes a single expression, quote it to include spaces")
+	}
+
+	expr, err := workspace.ParseQueryExpr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	qu := workspace.NewQuery(ws, workspace.RootLabel)
+	if err := qu.Update(ctx, 0); err != nil {
+		return err
+	}
+	targets, err := qu.Targets(ctx)
+	if err != nil {
+		return err
+	}
+
+	return printTargets(m.stdout, expr.Filter(targets), *format)
+}
+
+func printTargets(w io.Writer, targets []*workspace.TargetInfo, format string) error {
+	switch format {
+	case formatLabels:
+		for _, t := range targets {
+			fmt.Fprintln(w, t.Label)
+		}
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "LABEL\tDESCRIPTION")
+		for _, t := range targets {
+			// only the first line fits in a table
+			desc, _, _ := strings.Cut(t.Description, "\n")
+			fmt.Fprintf(tw, "%s\t%s\n", t.Label, desc)
+		}
+		return tw.Flush()
+	case formatJSON:
+		if targets == nil {
+			targets = []*workspace.TargetInfo{}
+		}
+		return writeJSON(w, targets)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return nil
+}
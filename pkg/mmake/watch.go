@@ -0,0 +1,67 @@
+package mmake
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aakarim/mmake/pkg/mmake/workspace"
+)
+
+// Watch runs the targets and runs them again whenever a file in their
+// packages changes, until it is interrupted.
+//
+//	mmake watch [-interval 500ms] [-debounce 200ms] //pkg:target... [VAR=value] [make flags]
+func (m *MMake) Watch(ctx context.Context, ws *workspace.Workspace, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", 0, "how often to check for changes (default 500ms)")
+	debounce := fs.Duration("debounce", 0, "how long files must stay unchanged before restarting (default 200ms)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if m.output == OutputJSON {
+		return fmt.Errorf("watch only supports text output")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	var targets, makeArgs []string
+	for i, a := range fs.Args() {
+		if !isLabel(a) {
+			makeArgs = fs.Args()[i:]
+			break
+		}
+		l, err := ws.ResolveLabel(a, wd)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, l.String())
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("watch requires at least one target")
+	}
+	if err := workspace.CheckMakeArgs(makeArgs); err != nil {
+		return err
+	}
+	expanded, err := workspace.ExpandPatterns(ctx, ws, targets)
+	if err != nil {
+		return err
+	}
+	if len(expanded) == 0 {
+		return fmt.Errorf("no targets match %s", strings.Join(targets, " "))
+	}
+
+	if m.dryRun {
+		return m.dryRunTargets(ctx, ws, expanded, makeArgs)
+	}
+	opts := workspace.WatchOptions{
+		RunOptions: workspace.RunOptions{Jobs: m.jobs, MakeArgs: makeArgs, Stdout: m.stdout, Stderr: m.stderr},
+		Interval:   *interval,
+		Debounce:   *debounce,
+	}
+	return ws.Watch(ctx, opts, expanded...)
+}
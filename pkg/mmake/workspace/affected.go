@@ -0,0 +1,128 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reasons a package is affected.
+const (
+	// AffectedChanged is a package that contains a changed file
+	AffectedChanged = "changed"
+	// AffectedDependent is a package with a target that depends on a target
+	// in an affected package
+	AffectedDependent = "dependent"
+)
+
+// AffectedPackage is a package affected by a set of changed files.
+type AffectedPackage struct {
+	Label  Label  `json:"label"`
+	Reason string `json:"reason"`
+}
+
+// ChangedFiles returns the files that changed since ref, relative to the
+// workspace root. This includes uncommitted changes and untracked files. A
+// renamed file is returned with both its old and its new path.
+func (w *Workspace) ChangedFiles(ctx context.Context, ref string) ([]string, error) {
+	diff, err := w.git(ctx, "diff", "--name-only", "--no-renames", "--relative", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := w.git(ctx, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	return append(diff, untracked...), nil
+}
+
+// git runs git in the workspace root and returns the lines it prints.
+func (w *Workspace) git(ctx context.Context, args ...string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = w.rootPath
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	var lines []string
+	for _, l := range strings.Split(stdout.String(), "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+// AffectedPackages maps the changed paths, relative to the workspace root, to
+// the packages that enclose them. Packages with targets that depend on targets
+// in those packages are affected too, transitively. Paths outside of every
+// package are ignored. The packages are sorted by label.
+func (q *Query) AffectedPackages(ctx context.Context, changed []string) ([]*AffectedPackage, error) {
+	pkgByDir := map[string]Label{}
+	for _, f := range q.files {
+		pkgByDir[path.Dir(f.Path)] = f.Label
+	}
+
+	reasons := map[Label]string{}
+	var queue []Label
+	for _, c := range changed {
+		p := filepath.ToSlash(c)
+		if !path.IsAbs(p) {
+			p = path.Join(q.ws.rootPath, p)
+		}
+		// find the nearest enclosing package
+		for dir := path.Dir(p); dir == q.ws.rootPath || strings.HasPrefix(dir, q.ws.rootPath+"/"); dir = path.Dir(dir) {
+			if label, ok := pkgByDir[dir]; ok {
+				if reasons[label] == "" {
+					reasons[label] = AffectedChanged
+					queue = append(queue, label)
+				}
+				break
+			}
+			if dir == q.ws.rootPath {
+				break
+			}
+		}
+	}
+
+	// packages that depend on each package
+	targets, err := q.Targets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dependents := map[Label][]Label{}
+	for _, t := range targets {
+		for _, p := range t.Prerequisites {
+			pkg := Label(p).Package()
+			if pkg != t.Package {
+				dependents[pkg] = append(dependents[pkg], t.Package)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		label := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[label] {
+			if reasons[d] == "" {
+				reasons[d] = AffectedDependent
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	affected := make([]*AffectedPackage, 0, len(reasons))
+	for label, reason := range reasons {
+		affected = append(affected, &AffectedPackage{Label: label, Reason: reason})
+	}
+	sort.Slice(affected, func(i, j int) bool {
+		return affected[i].Label < affected[j].Label
+	})
+	return affected, nil
+}
@@ -0,0 +1,102 @@
+package workspace
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestQuery_AffectedPackages(t *testing.T) {
+	files := map[string]string{
+		"Makefile":                "lint:\n\techo lint\n",
+		"lib/Makefile":            "build:\n\techo build\n",
+		"services/auth/Makefile":  "build: //lib:build\n\techo build\n",
+		"services/api/Makefile":   "deploy: //services/auth:build\n\techo deploy\n",
+		"services/other/Makefile": "build:\n\techo build\n",
+	}
+	tests := []struct {
+		name    string
+		changed []string
+		want    []*AffectedPackage
+	}{
+		{
+			name:    "nearest enclosing package",
+			changed: []string{"services/other/cmd/main.go"},
+			want: []*AffectedPackage{
+				{Label: "//services/other", Reason: AffectedChanged},
+			},
+		},
+		{
+			name:    "dependents are affected transitively",
+			changed: []string{"lib/lib.go"},
+			want: []*AffectedPackage{
+				{Label: "//lib", Reason: AffectedChanged},
+				{Label: "//services/api", Reason: AffectedDependent},
+				{Label: "//services/auth", Reason: AffectedDependent},
+			},
+		},
+		{
+			name:    "files outside packages belong to the root package",
+			changed: []string{"README.md", "services/other/Makefile"},
+			want: []*AffectedPackage{
+				{Label: "//", Reason: AffectedChanged},
+				{Label: "//services/other", Reason: AffectedChanged},
+			},
+		},
+		{
+			name:    "paths outside of the workspace are ignored",
+			changed: []string{"../other/Makefile"},
+			want:    []*AffectedPackage{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := writeWorkspace(t, files)
+			q := NewQuery(w, RootLabel)
+			if err := q.Update(context.Background(), 0); err != nil {
+				t.Fatal(err)
+			}
+			got, err := q.AffectedPackages(context.Background(), tt.changed)
+			if err != nil {
+				t.Fatalf("Query.AffectedPackages() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query.AffectedPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspace_ChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	w := writeWorkspace(t, map[string]string{
+		"a/Makefile": "build:\n",
+		"a/file.txt": "moved",
+		"b/Makefile": "build:\n",
+	})
+	ctx := context.Background()
+	git := func(args ...string) {
+		t.Helper()
+		if _, err := w.git(ctx, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	git("mv", "a/file.txt", "b/file.txt")
+
+	got, err := w.ChangedFiles(ctx, "HEAD")
+	if err != nil {
+		t.Fatalf("Workspace.ChangedFiles() error = %v", err)
+	}
+	// the package a file moved out of is affected too
+	sort.Strings(got)
+	if want := []string{"a/file.txt", "b/file.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Workspace.ChangedFiles() = %v, want %v", got, want)
+	}
+}
@@ -1,3 +1,4 @@
 package workspace
 
+// BuildDir is the default name of the build output directory.
 const BuildDir = "build-out"
@@ -0,0 +1,307 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aakarim/mmake/internal/makefile"
+)
+
+const (
+	// inputsAnnotation declares the inputs of a target, as globs relative to
+	// the package directory, in a comment in its recipe
+	inputsAnnotation = "# mmake:inputs"
+	// outputsAnnotation declares the outputs of a target, as paths relative
+	// to the package output directory, in a comment in its recipe
+	outputsAnnotation = "# mmake:outputs"
+)
+
+// cacheSpec describes a target whose outputs can be cached, e.g.
+//
+//	build:
+//		# mmake:inputs config.cue schemas
+//		# mmake:outputs config.yaml
+//		cue export $(MM_PATH)/config.cue -o $(MM_OUT_PATH)/config.yaml
+type cacheSpec struct {
+	target  *makefile.Target
+	inputs  []string
+	outputs []string
+	// prerequisites are the local prerequisites of the target with a rule,
+	// followed transitively. make runs them too, so their recipes are part of
+	// the key
+	prerequisites []*makefile.Target
+	// dependencies are the cache keys of the label prerequisites, which
+	// mmake runs first. Their outputs can be inputs of the target
+	dependencies []string
+	// image is the container image the target runs in, if any
+	image string
+}
+
+// isAnnotation returns true if the recipe line is an mmake annotation
+func isAnnotation(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, inputsAnnotation) || strings.HasPrefix(line, outputsAnnotation) ||
+		strings.HasPrefix(line, imageAnnotation)
+}
+
+// getCacheSpec returns the cache spec of the target, or nil if the target
+// doesn't declare both its inputs and outputs. Only targets in Makefiles can
+// declare them.
+func getCacheSpec(targetFilePath, targetName string) (*cacheSpec, error) {
+	if providerFor(targetFilePath) != nil {
+		return nil, nil
+	}
+	f, err := os.Open(targetFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("open build file: %w", err)
+	}
+	defer f.Close()
+
+	mf, err := makefile.Parse(f)
+	if err != nil {
+		return nil, nil
+	}
+	t := mf.Target(targetName)
+	if t == nil {
+		return nil, nil
+	}
+
+	spec := &cacheSpec{target: t}
+	for _, l := range strings.Split(t.Body, "\n") {
+		l = strings.TrimSpace(l)
+		if v := strings.TrimPrefix(l, inputsAnnotation); v != l {
+			spec.inputs = append(spec.inputs, strings.Fields(v)...)
+		}
+		if v := strings.TrimPrefix(l, outputsAnnotation); v != l {
+			spec.outputs = append(spec.outputs, strings.Fields(v)...)
+		}
+	}
+	if len(spec.inputs) == 0 || len(spec.outputs) == 0 {
+		return nil, nil
+	}
+
+	visited := map[string]bool{targetName: true}
+	var visit func(t *makefile.Target)
+	visit = func(t *makefile.Target) {
+		for _, p := range t.Prerequisites {
+			if visited[p] || isLabelPrerequisite(p) {
+				continue
+			}
+			visited[p] = true
+			if pt := mf.Target(p); pt != nil {
+				spec.prerequisites = append(spec.prerequisites, pt)
+				visit(pt)
+			}
+		}
+	}
+	visit(t)
+	return spec, nil
+}
+
+// cacheDir returns the directory the target outputs are cached in.
+func (w *Workspace) cacheDir() (string, error) {
+	if w.config.CacheDir != "" {
+		if filepath.IsAbs(w.config.CacheDir) {
+			return w.config.CacheDir, nil
+		}
+		return filepath.Join(w.rootPath, w.config.CacheDir), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mmake"), nil
+}
+
+// cacheKey hashes everything that can change the outputs of the target: its
+// label, its recipe and those of its local prerequisites, the cache keys of
+// its label prerequisites, the environment mmake gives it and its input files.
+func (w *Workspace) cacheKey(label string, spec *cacheSpec, pkgDir string, env []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "label %s\n", label)
+	fmt.Fprintf(h, "make %s\n", w.config.Make)
+	fmt.Fprintf(h, "recipe %q\n", spec.target.Body)
+	for _, p := range spec.prerequisites {
+		fmt.Fprintf(h, "prerequisite %s %q\n", p.Name, p.Body)
+	}
+	for _, d := range spec.dependencies {
+		fmt.Fprintf(h, "dependency %s\n", d)
+	}
+	if spec.image != "" {
+		fmt.Fprintf(h, "image %s\n", spec.image)
+	}
+
+	env = append([]string{}, env...)
+	sort.Strings(env)
+	for _, e := range env {
+		fmt.Fprintf(h, "env %q\n", e)
+	}
+
+	inputs, err := w.expandInputs(pkgDir, spec.inputs)
+	if err != nil {
+		return "", err
+	}
+	for _, in := range inputs {
+		rel, err := filepath.Rel(pkgDir, in)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "input %q\n", filepath.ToSlash(rel))
+		if err := hashFile(h, in); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// errNoInputMatches is returned for an input glob that matches no files.
+var errNoInputMatches = errors.New("no files match")
+
+// expandInputs returns the sorted files matching the input globs. Directories
+// include every file below them.
+func (w *Workspace) expandInputs(pkgDir string, globs []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	for _, g := range globs {
+		matches, err := filepath.Glob(filepath.Join(pkgDir, g))
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", g, err)
+		}
+		if matches == nil {
+			return nil, fmt.Errorf("input %s: %w", g, errNoInputMatches)
+		}
+		for _, m := range matches {
+			if err := filepath.WalkDir(m, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					for _, v := range w.ignoreDirs {
+						if d.Name() == v {
+							return filepath.SkipDir
+						}
+					}
+					return nil
+				}
+				if !seen[p] {
+					seen[p] = true
+					files = append(files, p)
+				}
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// restoreOutputs copies the cached outputs into the output directory. It
+// returns false if there is no cache entry for the key.
+func restoreOutputs(cacheDir, key, outDir string, outputs []string) (bool, error) {
+	entry := filepath.Join(cacheDir, key)
+	if _, err := os.Stat(entry); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, out := range outputs {
+		if err := copyPath(filepath.Join(entry, out), filepath.Join(outDir, out)); err != nil {
+			return false, fmt.Errorf("restore output %s: %w", out, err)
+		}
+	}
+	return true, nil
+}
+
+// storeOutputs copies the outputs into a new cache entry for the key. The
+// entry is written to a temporary directory first so that a partially
+// written entry is never restored.
+func storeOutputs(cacheDir, key, outDir string, outputs []string) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(cacheDir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, out := range outputs {
+		if err := copyPath(filepath.Join(outDir, out), filepath.Join(tmp, out)); err != nil {
+			return fmt.Errorf("store output %s: %w", out, err)
+		}
+	}
+
+	entry := filepath.Join(cacheDir, key)
+	if err := os.Rename(tmp, entry); err != nil {
+		// another run may have stored the same entry in the meantime
+		if _, statErr := os.Stat(entry); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// copyPath copies a file or a directory tree from src to dst.
+func copyPath(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(p, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,197 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWorkspace_RunTargets_cache(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile": "build:\n" +
+			"\t# Build the config\n" +
+			"\t# mmake:inputs config.txt\n" +
+			"\t# mmake:outputs config.out\n" +
+			"\t@cat $(MM_PATH)/config.txt > $(MM_OUT_PATH)/config.out\n" +
+			"\t@echo run >> $(MM_ROOT).runs\n",
+		"api/config.txt": "v1",
+	})
+	w.config.CacheDir = ".cache"
+	ctx := context.Background()
+	out := filepath.Join(w.buildRoot(), "api", "config.out")
+
+	run := func(wantStatus string) {
+		t.Helper()
+		results, err := w.RunTargets(ctx, RunOptions{}, "//api:build")
+		if err != nil {
+			t.Fatalf("Workspace.RunTargets() error = %v", err)
+		}
+		if results[0].Status != wantStatus {
+			t.Errorf("Workspace.RunTargets() status = %v, want %v", results[0].Status, wantStatus)
+		}
+	}
+	wantOutput := func(want string) {
+		t.Helper()
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("output = %q, want %q", b, want)
+		}
+	}
+
+	run(StatusSucceeded)
+	wantOutput("v1")
+
+	// nothing changed, so the outputs are restored even if they were removed
+	if err := os.RemoveAll(w.buildRoot()); err != nil {
+		t.Fatal(err)
+	}
+	run(StatusCached)
+	wantOutput("v1")
+
+	// changing an input runs the target again
+	if err := os.WriteFile(filepath.Join(w.rootPath, "api", "config.txt"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(StatusSucceeded)
+	wantOutput("v2")
+
+	runs, err := os.ReadFile(filepath.Join(w.rootPath, WorkspaceFile+".runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 2 {
+		t.Errorf("target ran %d times, want 2", n)
+	}
+}
+
+func TestWorkspace_RunTargets_cacheLabelPrerequisite(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"lib/Makefile": "build:\n" +
+			"\t# mmake:inputs src.txt\n" +
+			"\t# mmake:outputs out.txt\n" +
+			"\t@cat $(MM_PATH)/src.txt > $(MM_OUT_PATH)/out.txt\n",
+		"lib/src.txt": "v1",
+		"api/Makefile": "build: //lib:build\n" +
+			"\t# mmake:inputs main.txt\n" +
+			"\t# mmake:outputs bundle.txt\n" +
+			"\t@cat $(MM_PATH)/main.txt $(MM_OUT_ROOT)/lib/out.txt > $(MM_OUT_PATH)/bundle.txt\n",
+		"api/main.txt":   "main ",
+		"web/Makefile":   "build: //tools:gen\n\t# mmake:inputs main.txt\n\t# mmake:outputs out\n\t@touch $(MM_OUT_PATH)/out\n",
+		"web/main.txt":   "main",
+		"tools/Makefile": "gen:\n\t@true\n",
+	})
+	w.config.CacheDir = ".cache"
+	ctx := context.Background()
+
+	run := func(label string, want ...string) {
+		t.Helper()
+		results, err := w.RunTargets(ctx, RunOptions{}, label)
+		if err != nil {
+			t.Fatalf("Workspace.RunTargets() error = %v", err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Status)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Workspace.RunTargets(%s) statuses = %v, want %v", label, got, want)
+		}
+	}
+
+	run("//api:build", StatusSucceeded, StatusSucceeded)
+	run("//api:build", StatusCached, StatusCached)
+
+	// a dependency with different outputs runs its dependents again
+	if err := os.WriteFile(filepath.Join(w.rootPath, "lib", "src.txt"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("//api:build", StatusSucceeded, StatusSucceeded)
+	b, err := os.ReadFile(filepath.Join(w.buildRoot(), "api", "bundle.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "main v2" {
+		t.Errorf("output = %q, want %q", b, "main v2")
+	}
+
+	// a dependency without a cache key could have changed anything
+	run("//web:build", StatusSucceeded, StatusSucceeded)
+	run("//web:build", StatusSucceeded, StatusSucceeded)
+}
+
+func TestDescribeTarget_skipsAnnotations(t *testing.T) {
+	spec, err := getCacheSpec(writeMakefile(t, "build:\n\t# Build it\n\t# mmake:inputs *.go\n\t# mmake:outputs bin\n\tgo build\n"), "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec == nil {
+		t.Fatal("getCacheSpec() = nil, want a spec")
+	}
+	if got := describeTarget(spec.target); got != "Build it" {
+		t.Errorf("describeTarget() = %q, want %q", got, "Build it")
+	}
+}
+
+func TestWorkspace_cacheKey_prerequisites(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{"api/config.txt": "v1"})
+	key := func(makefile string) string {
+		t.Helper()
+		p := filepath.Join(w.rootPath, "api", "Makefile")
+		if err := os.WriteFile(p, []byte(makefile), 0644); err != nil {
+			t.Fatal(err)
+		}
+		spec, err := getCacheSpec(p, "build")
+		if err != nil || spec == nil {
+			t.Fatalf("getCacheSpec() = %v, %v, want a spec", spec, err)
+		}
+		k, err := w.cacheKey("//api:build", spec, filepath.Dir(p), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	build := "build: gen //lib:build\n\t# mmake:inputs config.txt\n\t# mmake:outputs out\n\tcp gen.txt out\n"
+
+	before := key(build + "gen: tools\n\techo v1 > gen.txt\ntools:\n\techo tools\n")
+	if after := key(build + "gen: tools\n\techo v2 > gen.txt\ntools:\n\techo tools\n"); after == before {
+		t.Error("cacheKey() didn't change with the recipe of a prerequisite")
+	}
+	if after := key(build + "gen: tools\n\techo v1 > gen.txt\ntools:\n\techo other tools\n"); after == before {
+		t.Error("cacheKey() didn't change with the recipe of a transitive prerequisite")
+	}
+}
+
+func TestWorkspace_RunTargets_cacheNoInputs(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile": "build:\n\t# mmake:inputs *.proto\n\t# mmake:outputs out\n\t@touch $(MM_OUT_PATH)/out\n",
+	})
+	w.config.CacheDir = ".cache"
+	var stderr strings.Builder
+	for i := 0; i < 2; i++ {
+		results, err := w.RunTargets(context.Background(), RunOptions{Stderr: &stderr}, "//api:build")
+		if err != nil {
+			t.Fatalf("Workspace.RunTargets() error = %v", err)
+		}
+		if results[0].Status != StatusSucceeded {
+			t.Errorf("Workspace.RunTargets() status = %v, want %v", results[0].Status, StatusSucceeded)
+		}
+	}
+	if !strings.Contains(stderr.String(), "without the cache") {
+		t.Errorf("Workspace.RunTargets() printed %q, want a note that the cache isn't used", stderr.String())
+	}
+}
+
+func writeMakefile(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "Makefile")
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,149 @@
+package workspace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WorkspaceFile is the name of the file that marks the root of a workspace.
+const WorkspaceFile = "WORKSPACE.mmake"
+
+// Config is the configuration read from the WORKSPACE.mmake file.
+//
+// The file is a list of `key = value` lines. Blank lines and lines starting
+// with '#' are ignored. Keys that hold lists may be repeated, e.g.
+//
+//	build_dir = build-out
+//	make = gmake
+//	ignore = dist .venv /generated bazel-*
+//	env = GOFLAGS=-mod=mod
+//	cache_dir = .cache/mmake
+//	discover = make
+//	container_engine = podman
+type Config struct {
+	// BuildDir is the name of the build output directory in the workspace root.
+	BuildDir string
+	// Make is the make binary used to run targets.
+	Make string
+	// IgnoreDirs are .gitignore style patterns, relative to the workspace
+	// root, of paths that are skipped when scanning along with the ones in
+	// .gitignore and .mmakeignore files. A plain name matches at any depth.
+	IgnoreDirs []string
+	// Env are default environment variables in the form KEY=value.
+	// They are overridden by the calling environment.
+	Env []string
+	// CacheDir is where the outputs of cacheable targets are stored, relative
+	// to the workspace root. Defaults to mmake in the user's cache directory.
+	CacheDir string
+	// Discover is how targets are found, either DiscoverParse or DiscoverMake.
+	Discover string
+	// ContainerEngine is the docker compatible CLI that runs targets with
+	// an image, e.g. docker or podman.
+	ContainerEngine string
+}
+
+// DefaultConfig returns the configuration used when the WORKSPACE.mmake file is empty.
+func DefaultConfig() *Config {
+	return &Config{
+		BuildDir:        BuildDir,
+		Make:            "make",
+		Discover:        DiscoverParse,
+		ContainerEngine: "docker",
+		IgnoreDirs: []string{
+			".git",
+			"vendor",
+			"node_modules",
+			"__pycache__",
+			"__snapshots__",
+			"__tests__",
+			"__mocks__",
+			"__fixtures__",
+		},
+	}
+}
+
+// LoadConfig reads the configuration from the workspace file at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses a workspace configuration on top of the defaults.
+func ParseConfig(r io.Reader) (*Config, error) {
+	cfg := DefaultConfig()
+
+	scan := bufio.NewScanner(r)
+	var lineNo int
+	for scan.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected `key = value`", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if err := cfg.set(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) set(key, value string) error {
+	switch key {
+	case "build_dir":
+		if value == "" || strings.ContainsAny(value, `/\`) {
+			return fmt.Errorf("build_dir must be a directory name, got %q", value)
+		}
+		c.BuildDir = value
+	case "make":
+		if value == "" {
+			return fmt.Errorf("make must not be empty")
+		}
+		c.Make = value
+	case "ignore":
+		c.IgnoreDirs = append(c.IgnoreDirs, strings.Fields(value)...)
+	case "env":
+		if !strings.Contains(value, "=") {
+			return fmt.Errorf("env must be in the form KEY=value, got %q", value)
+		}
+		c.Env = append(c.Env, value)
+	case "cache_dir":
+		c.CacheDir = value
+	case "discover":
+		if value != DiscoverParse && value != DiscoverMake {
+			return fmt.Errorf("discover must be %s or %s, got %q", DiscoverParse, DiscoverMake, value)
+		}
+		c.Discover = value
+	case "container_engine":
+		if value == "" {
+			return fmt.Errorf("container_engine must not be empty")
+		}
+		c.ContainerEngine = value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package workspace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    func() *Config
+		wantErr bool
+	}{
+		{
+			name:  "empty file uses defaults",
+			input: "",
+			want:  DefaultConfig,
+		},
+		{
+			name: "all keys",
+			input: `# workspace config
+build_dir = out
+make = gmake
+
+ignore = dist .venv
+ignore = bazel-out
+env = FOO=bar
+env = BAZ=a=b
+discover = make
+container_engine = podman
+`,
+			want: func() *Config {
+				cfg := DefaultConfig()
+				cfg.BuildDir = "out"
+				cfg.Make = "gmake"
+				cfg.IgnoreDirs = append(cfg.IgnoreDirs, "dist", ".venv", "bazel-out")
+				cfg.Env = []string{"FOO=bar", "BAZ=a=b"}
+				cfg.Discover = DiscoverMake
+				cfg.ContainerEngine = "podman"
+				return cfg
+			},
+		},
+		{
+			name:    "unknown key",
+			input:   "foo = bar",
+			wantErr: true,
+		},
+		{
+			name:    "missing equals",
+			input:   "build_dir out",
+			wantErr: true,
+		},
+		{
+			name:    "build dir must be a name",
+			input:   "build_dir = out/dir",
+			wantErr: true,
+		},
+		{
+			name:    "unknown discovery mode",
+			input:   "discover = guess",
+			wantErr: true,
+		},
+		{
+			name:    "env must be an assignment",
+			input:   "env = FOO",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfig(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := tt.want(); !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewWithConfig_ignoresBuildDir(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BuildDir = "out"
+	ws := NewWithConfig("/test/workspace", cfg)
+
+	var found bool
+	for _, d := range ws.ignoreDirs {
+		if d == "out" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ignoreDirs = %v, want it to contain the build dir", ws.ignoreDirs)
+	}
+}
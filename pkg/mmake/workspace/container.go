@@ -0,0 +1,252 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aakarim/mmake/internal/makefile"
+)
+
+// imageAnnotation runs a target inside a container made from the image.
+// In a recipe it applies to that target and on a line of its own outside of
+// any recipe it applies to every target in the package, e.g.
+//
+//	# mmake:image golang:1.22
+//
+//	build:
+//		# mmake:image cuelang/cue:0.6
+//		cue export $(MM_PATH)/config.cue -o $(MM_OUT_PATH)/config.yaml
+const imageAnnotation = "# mmake:image"
+
+// containerRoot is where the workspace root is mounted in containers.
+const containerRoot = "/workspace"
+
+// Mount makes a host directory available in a container.
+type Mount struct {
+	Source string
+	Target string
+}
+
+// Container is a command to run inside a container.
+type Container struct {
+	Image  string
+	Mounts []Mount
+	// Dir is the working directory in the container
+	Dir string
+	// Env are the variables set in the container, in the form KEY=value
+	Env     []string
+	Command []string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// ContainerEngine runs commands inside containers.
+type ContainerEngine interface {
+	// Run runs the container until its command exits. The container must be
+	// stopped once ctx is done.
+	Run(ctx context.Context, c *Container) error
+}
+
+// ContainerCLI runs containers with a docker compatible CLI, such as docker
+// or podman.
+type ContainerCLI struct {
+	// Binary is the CLI to run, e.g. docker
+	Binary string
+}
+
+// Run runs the container with `<binary> run` and removes it afterwards.
+func (e *ContainerCLI) Run(ctx context.Context, c *Container) error {
+	// the container is named so that it can be stopped, killing the CLI
+	// leaves it running
+	name := fmt.Sprintf("mmake-%d-%d", os.Getpid(), time.Now().UnixNano())
+	args := []string{"run", "--rm", "-i", "--name", name}
+	for _, m := range c.Mounts {
+		args = append(args, "-v", m.Source+":"+m.Target)
+	}
+	if c.Dir != "" {
+		args = append(args, "-w", c.Dir)
+	}
+	for _, e := range c.Env {
+		args = append(args, "-e", e)
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && filepath.Base(e.Binary) == "docker" {
+		// keep the outputs owned by the user, rootless podman already does
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	args = append(args, c.Image)
+	args = append(args, c.Command...)
+
+	cmd := exec.Command(e.Binary, args...)
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = exec.Command(e.Binary, "rm", "-f", name).Run()
+		case <-stop:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// SetContainerEngine sets the engine targets with an image are run with by
+// default, instead of the container_engine CLI from the configuration.
+func (w *Workspace) SetContainerEngine(e ContainerEngine) {
+	w.containerEngine = e
+}
+
+func (w *Workspace) getContainerEngine() ContainerEngine {
+	if w.containerEngine != nil {
+		return w.containerEngine
+	}
+	return &ContainerCLI{Binary: w.config.ContainerEngine}
+}
+
+// getImage returns the image the target runs in, or an empty string if it
+// runs on the host. An image on the target wins over one for the package.
+// Only targets in Makefiles can run in a container.
+func getImage(targetFilePath, targetName string) (string, error) {
+	if providerFor(targetFilePath) != nil {
+		return "", nil
+	}
+	f, err := makefile.ParseFile(targetFilePath)
+	if err != nil {
+		return "", fmt.Errorf("parse build file: %w", err)
+	}
+	if t := f.Target(targetName); t != nil {
+		for _, l := range strings.Split(t.Body, "\n") {
+			if image, ok := parseImageAnnotation(l); ok {
+				return image, nil
+			}
+		}
+	}
+	// comments directly above a rule are part of the rule, so they only
+	// apply to its targets
+	var comments, targetComments []*makefile.Comment
+	ruleComments := map[*makefile.Comment]bool{}
+	f.Walk(func(n makefile.Node) {
+		switch n := n.(type) {
+		case *makefile.Comment:
+			comments = append(comments, n)
+		case *makefile.Rule:
+			for _, c := range n.Doc {
+				ruleComments[c] = true
+			}
+			for _, t := range n.Targets {
+				if t == targetName {
+					targetComments = append(targetComments, n.Doc...)
+					break
+				}
+			}
+		}
+	})
+	// the other comments apply to the whole package
+	for _, c := range comments {
+		if !ruleComments[c] {
+			targetComments = append(targetComments, c)
+		}
+	}
+	for _, c := range targetComments {
+		if image, ok := parseImageAnnotation("# " + strings.TrimSpace(c.Text)); ok {
+			return image, nil
+		}
+	}
+	return "", nil
+}
+
+func parseImageAnnotation(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	v := strings.TrimPrefix(line, imageAnnotation)
+	if v == line {
+		return "", false
+	}
+	v = strings.TrimSpace(v)
+	return v, v != ""
+}
+
+// containerPath returns the path in the container of a host path in the
+// workspace, or false if the path is outside of the workspace.
+func (w *Workspace) containerPath(p string) (string, bool) {
+	root, err := filepath.Abs(w.rootPath)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path.Join(containerRoot, filepath.ToSlash(rel)), true
+}
+
+// runInContainer runs the invocation with make in a container made from its
+// image.
+func (w *Workspace) runInContainer(ctx context.Context, inv *Invocation) error {
+	c, err := w.makeContainer(inv.Image, makeCommandArgs(inv.BuildFile, inv.Makefile, inv.Target, inv.Args), append(append([]string{}, inv.DefaultEnv...), inv.Env...))
+	if err != nil {
+		return err
+	}
+	c.Stdin, c.Stdout, c.Stderr = inv.Stdin, inv.Stdout, inv.Stderr
+	return w.getContainerEngine().Run(ctx, c)
+}
+
+// makeContainer returns the container that runs make with args. The
+// workspace root is mounted at containerRoot and the paths in the arguments
+// and the MM_ variables are changed to match. The calling environment is not
+// passed to the container.
+func (w *Workspace) makeContainer(image string, args, env []string) (*Container, error) {
+	root, err := filepath.Abs(w.rootPath)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	command := []string{w.config.Make}
+	for _, a := range args {
+		if p, ok := w.containerPath(a); ok && filepath.IsAbs(a) {
+			a = p
+		} else if k, v, ok := strings.Cut(a, "="); ok && !strings.HasPrefix(a, "-") {
+			// variables like MMAKE_MAKEFILE hold paths too
+			if p, ok := w.containerPath(v); ok && filepath.IsAbs(v) {
+				a = k + "=" + p
+			}
+		}
+		command = append(command, a)
+	}
+	var containerEnv []string
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		if p, ok := w.containerPath(v); ok && filepath.IsAbs(v) {
+			v = p
+		}
+		containerEnv = append(containerEnv, k+"="+v)
+	}
+	dir, ok := w.containerPath(wd)
+	if !ok {
+		dir = containerRoot
+	}
+
+	return &Container{
+		Image:   image,
+		Mounts:  []Mount{{Source: root, Target: containerRoot}},
+		Dir:     dir,
+		Env:     containerEnv,
+		Command: command,
+	}, nil
+}
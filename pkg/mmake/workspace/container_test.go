@@ -0,0 +1,160 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeEngine records the containers it is asked to run.
+type fakeEngine struct {
+	containers []*Container
+}
+
+func (e *fakeEngine) Run(ctx context.Context, c *Container) error {
+	e.containers = append(e.containers, c)
+	fmt.Fprintln(c.Stdout, "ran in", c.Image)
+	return nil
+}
+
+func TestWorkspace_RunTargets_container(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile": "# mmake:image golang:1.22\nbuild:\n\tgo build\nconfig:\n\t# mmake:image cuelang/cue:0.6\n\tcue export\n",
+		"web/Makefile": "build:\n\t@true\n",
+	})
+	engine := &fakeEngine{}
+	w.SetContainerEngine(engine)
+
+	if _, err := w.RunTargets(context.Background(), RunOptions{}, "//api:build", "//api:config", "//web:build"); err != nil {
+		t.Fatalf("Workspace.RunTargets() error = %v", err)
+	}
+	if len(engine.containers) != 2 {
+		t.Fatalf("ran %d containers, want 2", len(engine.containers))
+	}
+
+	build, config := engine.containers[0], engine.containers[1]
+	if build.Image != "golang:1.22" || config.Image != "cuelang/cue:0.6" {
+		t.Errorf("images = %s, %s, want golang:1.22, cuelang/cue:0.6", build.Image, config.Image)
+	}
+	root, _ := filepath.Abs(w.rootPath)
+	if want := []Mount{{Source: root, Target: "/workspace"}}; !reflect.DeepEqual(build.Mounts, want) {
+		t.Errorf("Container.Mounts = %v, want %v", build.Mounts, want)
+	}
+	if want := []string{"make", "-f", "/workspace/api/Makefile", "build"}; !reflect.DeepEqual(build.Command, want) {
+		t.Errorf("Container.Command = %v, want %v", build.Command, want)
+	}
+	wantEnv := []string{
+		"MM_ROOT=/workspace/WORKSPACE.mmake",
+		"MM_PATH=/workspace/api",
+		"MM_OUT_ROOT=/workspace/build-out",
+		"MM_OUT_PATH=/workspace/build-out/api",
+		"WS_ROOT=/workspace",
+	}
+	if !reflect.DeepEqual(build.Env, wantEnv) {
+		t.Errorf("Container.Env = %v, want %v", build.Env, wantEnv)
+	}
+}
+
+func TestWorkspace_RunTargets_containerLabelPrerequisite(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":  "# mmake:image golang:1.22\n\ninclude $(dir $(lastword $(MAKEFILE_LIST)))common.mk\n\nbuild: //auth:build\n\tgo build\n",
+		"api/common.mk": "GOFLAGS = -v\n",
+		"auth/Makefile": "build:\n\t@true\n",
+	})
+	engine := &fakeEngine{}
+	w.SetContainerEngine(engine)
+
+	if _, err := w.RunTargets(context.Background(), RunOptions{}, "//api:build"); err != nil {
+		t.Fatalf("Workspace.RunTargets() error = %v", err)
+	}
+	if len(engine.containers) != 1 {
+		t.Fatalf("ran %d containers, want 1", len(engine.containers))
+	}
+	// the copy finds the original Makefile from a variable, which has to
+	// point into the container too
+	want := []string{"make", "-f", "/workspace/build-out/.mmake/api/Makefile", "MMAKE_MAKEFILE=/workspace/api/Makefile", "build"}
+	if got := engine.containers[0].Command; !reflect.DeepEqual(got, want) {
+		t.Errorf("Container.Command = %v, want %v", got, want)
+	}
+	b, err := os.ReadFile(filepath.Join(w.buildRoot(), ".mmake", "api", "Makefile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), w.rootPath) {
+		t.Errorf("the copy of the Makefile contains the host path %s:\n%s", w.rootPath, b)
+	}
+}
+
+func TestGetImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		target  string
+		want    string
+	}{
+		{
+			name:    "rule comment",
+			content: "# mmake:image golang:1.22\nbuild:\n\tgo build\nlint:\n\tgolangci-lint run\n",
+			target:  "build",
+			want:    "golang:1.22",
+		},
+		{
+			name:    "other rule's comment",
+			content: "# mmake:image golang:1.22\nbuild:\n\tgo build\nlint:\n\tgolangci-lint run\n",
+			target:  "lint",
+		},
+		{
+			name:    "package comment",
+			content: "# mmake:image golang:1.22\n\nbuild:\n\tgo build\nlint:\n\tgolangci-lint run\n",
+			target:  "lint",
+			want:    "golang:1.22",
+		},
+		{
+			name:    "rule comment wins over package comment",
+			content: "# mmake:image golang:1.22\n\n# mmake:image golang:1.21\nlint:\n\tgolangci-lint run\n",
+			target:  "lint",
+			want:    "golang:1.21",
+		},
+		{
+			name:    "recipe wins",
+			content: "# mmake:image golang:1.22\nbuild:\n\t# mmake:image golang:1.21\n\tgo build\n",
+			target:  "build",
+			want:    "golang:1.21",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getImage(writeMakefile(t, tt.content), tt.target)
+			if err != nil {
+				t.Fatalf("getImage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspace_containerPath(t *testing.T) {
+	w := New("/home/me/repo")
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "/home/me/repo", want: "/workspace", wantOK: true},
+		{path: "/home/me/repo/services/api", want: "/workspace/services/api", wantOK: true},
+		{path: "/home/me/other", wantOK: false},
+		{path: "/home/me/repository", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := w.containerPath(tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Workspace.containerPath(%s) = %s, %v, want %s, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aakarim/mmake/internal/makefile"
+)
+
+// ErrDependencyCycle is returned when targets depend on each other.
+type ErrDependencyCycle struct {
+	Cycle []string
+}
+
+func (e *ErrDependencyCycle) Error() string {
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// isLabelPrerequisite returns true if the prerequisite refers to a target
+// in another package, e.g. //services/auth:build
+func isLabelPrerequisite(prereq string) bool {
+	return strings.HasPrefix(prereq, RootLabel)
+}
+
+// TargetDependencies returns the cross-package prerequisites of the target.
+// Prerequisites are followed through local targets in the same build file, so
+//
+//	deploy: build
+//	build: //services/auth:build
+//
+// makes //services/auth:build a dependency of deploy. Only targets in
+// Makefiles have cross-package prerequisites.
+func (w *Workspace) TargetDependencies(ctx context.Context, target string) ([]string, error) {
+	targetFilePath, err := w.getBuildFile(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if providerFor(targetFilePath) != nil {
+		return nil, nil
+	}
+	b, err := os.ReadFile(targetFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("read build file: %w", err)
+	}
+	mf, err := makefile.Parse(bytes.NewReader(b))
+	if err != nil {
+		// leave it to make to report
+		return nil, nil
+	}
+
+	var deps []string
+	seenDeps := map[string]bool{}
+	visited := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+
+		t := mf.Target(name)
+		if t == nil {
+			// not a literal rule, so leave it to make
+			return
+		}
+		for _, p := range t.Prerequisites {
+			if !isLabelPrerequisite(p) {
+				visit(p)
+				continue
+			}
+			if !seenDeps[p] {
+				seenDeps[p] = true
+				deps = append(deps, p)
+			}
+		}
+	}
+	visit(Label(target).Target())
+
+	return deps, nil
+}
+
+// ResolveTargets returns the given targets and all of their cross-package
+// dependencies in the order they should be run. Every target appears once
+// and after all of its dependencies.
+func (w *Workspace) ResolveTargets(ctx context.Context, targets ...string) ([]string, error) {
+	g, err := w.resolveGraph(ctx, targets...)
+	if err != nil {
+		return nil, err
+	}
+	return g.order, nil
+}
+
+// targetGraph holds the targets to run and their cross-package dependencies.
+type targetGraph struct {
+	// order is a topological order of the targets, dependencies first
+	order []string
+	// deps are the direct dependencies of each target
+	deps map[string][]string
+	// roots are the targets that were asked for, as opposed to the ones that
+	// only run as dependencies
+	roots map[string]bool
+}
+
+// makeArgs returns the arguments for make for the target. Only the targets
+// that were asked for get them, arguments like ARGS=--fix are meant for a
+// single recipe.
+func (g *targetGraph) makeArgs(target string, args []string) []string {
+	if !g.roots[target] {
+		return nil
+	}
+	return args
+}
+
+func (w *Workspace) resolveGraph(ctx context.Context, targets ...string) (*targetGraph, error) {
+	const (
+		visiting = iota + 1
+		done
+	)
+	g := &targetGraph{deps: map[string][]string{}, roots: map[string]bool{}}
+	state := map[string]int{}
+	var stack []string
+
+	var visit func(target string) error
+	visit = func(target string) error {
+		switch state[target] {
+		case done:
+			return nil
+		case visiting:
+			// the cycle starts at the first occurrence of the target in the stack
+			for i, t := range stack {
+				if t == target {
+					cycle := append([]string{}, stack[i:]...)
+					return &ErrDependencyCycle{Cycle: append(cycle, target)}
+				}
+			}
+		}
+
+		state[target] = visiting
+		stack = append(stack, target)
+
+		deps, err := w.TargetDependencies(ctx, target)
+		if err != nil {
+			return fmt.Errorf("resolve dependencies of %s: %w", target, err)
+		}
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[target] = done
+		g.deps[target] = deps
+		g.order = append(g.order, target)
+		return nil
+	}
+
+	for _, t := range targets {
+		g.roots[t] = true
+		if err := visit(t); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// runnableBuildFile returns the path to the build file that make should run.
+// Make can't parse label prerequisites, so if the build file contains any
+// then a copy without them is written to the build directory. mmake runs the
+// labels itself before running the target.
+func (w *Workspace) runnableBuildFile(targetFilePath string) (string, error) {
+	runnablePath, src, err := w.runnableSource(targetFilePath)
+	if err != nil || runnablePath == targetFilePath {
+		return runnablePath, err
+	}
+	if err := os.MkdirAll(filepath.Dir(runnablePath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(runnablePath, []byte(src), 0644); err != nil {
+		return "", fmt.Errorf("write build file: %w", err)
+	}
+	return runnablePath, nil
+}
+
+// makefileVariable is set on make's command line to the path of the original
+// Makefile when make runs a copy of it. It is a variable rather than part of
+// the copy so that the path is changed to match in a container.
+const makefileVariable = "MMAKE_MAKEFILE"
+
+// runnableSource returns the path to the build file that make should run
+// and its source, without writing anything. The path is the build file itself
+// if it has no label prerequisites, or if it isn't a Makefile. A copy starts by
+// putting the original Makefile, from makefileVariable, back in place of
+// itself in $(MAKEFILE_LIST), so that includes relative to the Makefile's own
+// directory keep working.
+func (w *Workspace) runnableSource(targetFilePath string) (runnablePath, src string, err error) {
+	b, err := os.ReadFile(targetFilePath)
+	if err != nil {
+		return "", "", fmt.Errorf("read build file: %w", err)
+	}
+	if providerFor(targetFilePath) != nil {
+		return targetFilePath, string(b), nil
+	}
+
+	src, changed, err := makefile.RemovePrerequisites(string(b), isLabelPrerequisite)
+	if err != nil {
+		return "", "", fmt.Errorf("parse build file: %w", err)
+	}
+	if !changed {
+		return targetFilePath, src, nil
+	}
+
+	rel, err := filepath.Rel(w.rootPath, targetFilePath)
+	if err != nil {
+		return "", "", err
+	}
+	src = fmt.Sprintf("MAKEFILE_LIST := $(filter-out $(lastword $(MAKEFILE_LIST)),$(MAKEFILE_LIST)) $(%s)\n", makefileVariable) + src
+	return filepath.Join(w.buildRoot(), ".mmake", rel), src, nil
+}
@@ -0,0 +1,136 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeWorkspace creates a workspace in a temporary directory with the given
+// files, keyed by their path relative to the root.
+func writeWorkspace(t *testing.T, files map[string]string) *Workspace {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(root)
+}
+
+func TestWorkspace_ResolveTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		targets   []string
+		want      []string
+		wantCycle bool
+	}{
+		{
+			name: "no dependencies",
+			files: map[string]string{
+				"api/Makefile": "build:\n\techo build\n",
+			},
+			targets: []string{"//api:build"},
+			want:    []string{"//api:build"},
+		},
+		{
+			name: "dependencies run first",
+			files: map[string]string{
+				"api/Makefile":  "deploy: //auth:build //lib:build\n\techo deploy\n",
+				"auth/Makefile": "build: //lib:build\n\techo build\n",
+				"lib/Makefile":  "build:\n\techo build\n",
+			},
+			targets: []string{"//api:deploy"},
+			want:    []string{"//lib:build", "//auth:build", "//api:deploy"},
+		},
+		{
+			name: "dependencies through local targets",
+			files: map[string]string{
+				"api/Makefile":  "deploy: build\n\techo deploy\nbuild: | //auth:build\n\techo build\n",
+				"auth/Makefile": "build:\n\techo build\n",
+			},
+			targets: []string{"//api:deploy"},
+			want:    []string{"//auth:build", "//api:deploy"},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"api/Makefile":  "build: //auth:build\n\techo build\n",
+				"auth/Makefile": "build: //api:build\n\techo build\n",
+			},
+			targets:   []string{"//api:build"},
+			wantCycle: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := writeWorkspace(t, tt.files)
+			got, err := w.ResolveTargets(context.Background(), tt.targets...)
+			var cycleErr *ErrDependencyCycle
+			if errors.As(err, &cycleErr) != tt.wantCycle {
+				t.Fatalf("Workspace.ResolveTargets() error = %v, wantCycle %v", err, tt.wantCycle)
+			}
+			if tt.wantCycle {
+				return
+			}
+			if err != nil {
+				t.Fatalf("Workspace.ResolveTargets() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Workspace.ResolveTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspace_runnableBuildFile(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":  "deploy: build //auth:build ; echo deploy\nbuild:\n\techo build\n",
+		"auth/Makefile": "build:\n\techo build\n",
+	})
+
+	got, err := w.runnableBuildFile(filepath.Join(w.rootPath, "auth/Makefile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(w.rootPath, "auth/Makefile"); got != want {
+		t.Errorf("Workspace.runnableBuildFile() = %v, want the original file %v", got, want)
+	}
+
+	got, err = w.runnableBuildFile(filepath.Join(w.rootPath, "api/Makefile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MAKEFILE_LIST := $(filter-out $(lastword $(MAKEFILE_LIST)),$(MAKEFILE_LIST)) $(MMAKE_MAKEFILE)\ndeploy: build; echo deploy\nbuild:\n\techo build\n"; string(b) != want {
+		t.Errorf("Workspace.runnableBuildFile() content = %q, want %q", b, want)
+	}
+}
+
+func TestWorkspace_RunTargets_relativeInclude(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":  "include $(dir $(lastword $(MAKEFILE_LIST)))common.mk\n\nbuild: //auth:build\n\t@echo $(GREETING) $(notdir $(firstword $(MAKEFILE_LIST)))\n",
+		"api/common.mk": "GREETING = hello\n",
+		"auth/Makefile": "build:\n\t@true\n",
+	})
+	var out bytes.Buffer
+	if _, err := w.RunTargets(context.Background(), RunOptions{Stdout: &out}, "//api:build"); err != nil {
+		t.Fatalf("Workspace.RunTargets() error = %v", err)
+	}
+	if want := "hello Makefile\n"; out.String() != want {
+		t.Errorf("Workspace.RunTargets() printed %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,179 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aakarim/mmake/internal/makefile"
+)
+
+// Ways of discovering the targets in a build file.
+const (
+	// DiscoverParse reads the targets from the build file without running make
+	DiscoverParse = "parse"
+	// DiscoverMake asks make for its database with `make -pRrq`, which also
+	// finds targets from included files and $(eval ...)
+	DiscoverMake = "make"
+)
+
+// discoveredTargets is a cached make database for a single build file.
+type discoveredTargets struct {
+	Path string `json:"path"`
+	// Makefiles are the modification times of the build file and the files
+	// it includes, keyed by their path
+	Makefiles map[string]int64   `json:"makefiles"`
+	Targets   []*makefile.Target `json:"targets"`
+}
+
+// discoverTargets returns the targets that make finds in the build file, and
+// the makefiles that make read for them. The result is cached until the
+// modification time of one of the makefiles changes.
+func (w *Workspace) discoverTargets(ctx context.Context, buildFilePath string) (targets []*makefile.Target, makefiles []string, err error) {
+	cachePath, err := w.discoverCachePath(buildFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b, err := os.ReadFile(cachePath); err == nil {
+		var cached discoveredTargets
+		if json.Unmarshal(b, &cached) == nil && cached.Path == buildFilePath &&
+			len(cached.Makefiles) > 0 && !modTimesChanged(cached.Makefiles) {
+			for m := range cached.Makefiles {
+				makefiles = append(makefiles, m)
+			}
+			sort.Strings(makefiles)
+			return cached.Targets, makefiles, nil
+		}
+	}
+
+	targets, makefiles, err = w.makeDatabase(ctx, buildFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	times, err := modTimes(makefiles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the cache only makes discovery faster, so failing to write it is not an error
+	if b, err := json.Marshal(&discoveredTargets{Path: buildFilePath, Makefiles: times, Targets: targets}); err == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			_ = os.WriteFile(cachePath, b, 0644)
+		}
+	}
+	return targets, makefiles, nil
+}
+
+// discoverCachePath returns where the make database of the build file is
+// cached. Relative includes depend on the working directory, so each one has
+// a database of its own.
+func (w *Workspace) discoverCachePath(buildFilePath string) (string, error) {
+	dir, err := w.cacheDir()
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(buildFilePath + "\n" + wd))
+	return filepath.Join(dir, "targets", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// makeDatabase runs make in the working directory with the same environment
+// as a target run and parses the database it prints. -q stops make from
+// running any recipes. The runnable copy isn't written, so discovery works in
+// a read-only workspace.
+func (w *Workspace) makeDatabase(ctx context.Context, buildFilePath string) (targets []*makefile.Target, makefiles []string, err error) {
+	runnablePath, src, err := w.runnableSource(buildFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	envVars, err := w.packageEnv(buildFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// make runs targets in the working directory, so relative includes are
+	// resolved from there
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, w.config.Make, append([]string{"-pRrq"}, makeCommandArgs(buildFilePath, runnablePath, "", nil)...)...)
+	if runnablePath != buildFilePath {
+		// make reads the source from stdin instead
+		cmd.Args[3] = "-"
+		cmd.Stdin = strings.NewReader(src)
+	}
+	cmd.Dir = wd
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(cmd.Env, w.config.Env...)
+	cmd.Env = append(cmd.Env, os.Environ()...)
+	cmd.Env = append(cmd.Env, envVars...)
+	// -q exits with 1 when the default goal is out of date, which is expected
+	runErr := cmd.Run()
+
+	targets, err = makefile.ParseDatabase(bytes.NewReader(stdout.Bytes()))
+	if err != nil {
+		if runErr != nil {
+			return nil, nil, fmt.Errorf("%s -pRrq: %w: %s", w.config.Make, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, nil, err
+	}
+
+	// make never sees the cross-package prerequisites, so add them back
+	f, err := makefile.ParseFile(buildFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range targets {
+		if parsed := f.Target(t.Name); parsed != nil {
+			for _, p := range parsed.Prerequisites {
+				if isLabelPrerequisite(p) {
+					t.Prerequisites = append(t.Prerequisites, p)
+				}
+			}
+		}
+	}
+	return targets, databaseMakefiles(stdout.Bytes(), cmd.Dir, buildFilePath), nil
+}
+
+// databaseMakefiles returns the existing makefiles in the $(MAKEFILE_LIST) of
+// the make database, with relative paths resolved from dir, starting with the
+// build file.
+func databaseMakefiles(db []byte, dir, buildFilePath string) []string {
+	makefiles := []string{buildFilePath}
+	seen := map[string]bool{buildFilePath: true}
+	scan := bufio.NewScanner(bytes.NewReader(db))
+	scan.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scan.Scan() {
+		list := strings.TrimPrefix(scan.Text(), "MAKEFILE_LIST := ")
+		if list == scan.Text() {
+			continue
+		}
+		for _, m := range strings.Fields(list) {
+			if !filepath.IsAbs(m) {
+				m = filepath.Join(dir, m)
+			}
+			// e.g. the temporary file make keeps its stdin in
+			if _, err := os.Stat(m); err != nil || seen[m] {
+				continue
+			}
+			seen[m] = true
+			makefiles = append(makefiles, m)
+		}
+	}
+	return makefiles
+}
@@ -0,0 +1,151 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuery_Update_DiscoverMake(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"Makefile": "include common.mk\n" +
+			"define RULE\ngen-$(1):\n\techo $(1)\nendef\n" +
+			"$(foreach n,a b,$(eval $(call RULE,$(n))))\n" +
+			".PHONY: run\nrun: gen-a //:lint\n\t# runs it\n\techo run\n",
+		"common.mk": "lint:\n\techo lint\n",
+	})
+	w.config.Discover = DiscoverMake
+	w.config.CacheDir = ".cache"
+	chdir(t, w.rootPath)
+
+	q := NewQuery(w, RootLabel)
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	// discovery doesn't write the runnable copy, the workspace may be read-only
+	if _, err := os.Stat(filepath.Join(w.buildRoot(), ".mmake", "Makefile")); !os.IsNotExist(err) {
+		t.Errorf("runnable copy written during discovery: %v", err)
+	}
+	want := []string{"gen-a", "gen-b", "lint", "run"}
+	if got := q.Files()[0].Targets; !reflect.DeepEqual(got, want) {
+		t.Errorf("Targets = %q, want %q", got, want)
+	}
+
+	targets, err := q.Targets(context.Background())
+	if err != nil {
+		t.Fatalf("Query.Targets() error = %v", err)
+	}
+	run := targets[3]
+	if run.Description != "runs it" || !reflect.DeepEqual(run.Prerequisites, []string{"//:gen-a", "//:lint"}) {
+		t.Errorf("run = %+v", run)
+	}
+
+	// the cached database is used until the build file or an include changes
+	buildFile := q.Files()[0].Path
+	cachePath, err := w.discoverCachePath(buildFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discover := func() []string {
+		t.Helper()
+		targets, _, err := w.discoverTargets(context.Background(), buildFile)
+		if err != nil {
+			t.Fatalf("Workspace.discoverTargets() error = %v", err)
+		}
+		var names []string
+		for _, t := range targets {
+			names = append(names, t.Name)
+		}
+		return names
+	}
+
+	stale := `{"path":"` + buildFile + `","makefiles":{"` + buildFile + `":0},"targets":[{"Name":"stale"}]}`
+	if err := os.WriteFile(cachePath, []byte(stale), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := discover(); !reflect.DeepEqual(got, want) {
+		t.Errorf("stale cache used: targets = %q, want %q", got, want)
+	}
+
+	info, err := os.Stat(buildFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := `{"path":"` + buildFile + `","makefiles":{"` + buildFile + `":` + strconv.FormatInt(info.ModTime().UnixNano(), 10) + `},"targets":[{"Name":"cached"}]}`
+	if err := os.WriteFile(cachePath, []byte(fresh), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := discover(); !reflect.DeepEqual(got, []string{"cached"}) {
+		t.Errorf("cache not used: targets = %q", got)
+	}
+
+	// targets added to an included file are found by the next update
+	if err := os.Remove(cachePath); err != nil {
+		t.Fatal(err)
+	}
+	discover()
+	common := filepath.Join(w.rootPath, "common.mk")
+	if err := os.WriteFile(common, []byte("lint:\n\techo lint\nfmt:\n\techo fmt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(common, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	want = []string{"fmt", "gen-a", "gen-b", "lint", "run"}
+	if got := q.Files()[0].Targets; !reflect.DeepEqual(got, want) {
+		t.Errorf("after changing an include: Targets = %q, want %q", got, want)
+	}
+}
+
+func TestQuery_Update_DiscoverMake_workingDirectory(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":  "include common.mk\nbuild:\n",
+		"api/common.mk": "lint:\n",
+	})
+	w.config.Discover = DiscoverMake
+	w.config.CacheDir = ".cache"
+
+	targets := func() []string {
+		t.Helper()
+		q := NewQuery(w, RootLabel)
+		if err := q.Update(context.Background(), 0); err != nil {
+			t.Fatalf("Query.Update() error = %v", err)
+		}
+		return q.Files()[0].Targets
+	}
+	// make resolves the include from the working directory when it runs a
+	// target, so discovery does too
+	chdir(t, w.rootPath)
+	if got, want := targets(), []string{"build"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("from the root: Targets = %q, want %q", got, want)
+	}
+	chdir(t, filepath.Join(w.rootPath, "api"))
+	if got, want := targets(), []string{"build", "lint"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("from the package: Targets = %q, want %q", got, want)
+	}
+}
+
+// chdir changes the working directory until the end of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
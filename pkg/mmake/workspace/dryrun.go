@@ -0,0 +1,132 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DryRun describes how a target would be run.
+type DryRun struct {
+	Label string `json:"label"`
+	// Command is the make invocation, starting with the make binary, or the
+	// command of the build file's provider
+	Command []string `json:"command"`
+	// Stdin is the source of the Makefile when make reads it from stdin.
+	// A Makefile with label prerequisites is run as a copy without them, which
+	// a dry run doesn't write
+	Stdin string `json:"stdin,omitempty"`
+	// Dir is the working directory the command is run in
+	Dir string `json:"dir"`
+	// Env are the variables mmake adds to the environment, the calling
+	// environment is left out
+	Env []string `json:"env"`
+	// Recipe is make's own -n expansion of the target, it is empty for build
+	// files that aren't Makefiles
+	Recipe string `json:"recipe"`
+	// Image is the container image the target runs in, if any. The command,
+	// directory and environment are then the ones in the container
+	Image string `json:"image,omitempty"`
+}
+
+// DryRunTargets returns how the targets and their cross-package dependencies
+// would be run, in the order they would run, without running them. makeArgs
+// are only passed to make for the targets themselves. Nothing is
+// written to the build directory. make -n is run to expand the recipes, which
+// still runs $(shell ...) calls and recursive $(MAKE) lines.
+func (w *Workspace) DryRunTargets(ctx context.Context, makeArgs []string, targets ...string) ([]*DryRun, error) {
+	g, err := w.resolveGraph(ctx, targets...)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*DryRun
+	for _, target := range g.order {
+		run, err := w.dryRunTarget(ctx, target, dir, g.makeArgs(target, makeArgs))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (w *Workspace) dryRunTarget(ctx context.Context, target, dir string, makeArgs []string) (*DryRun, error) {
+	targetFilePath, err := w.getBuildFile(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	runnablePath, src, err := w.runnableSource(targetFilePath)
+	if err != nil {
+		return nil, err
+	}
+	envVars, err := w.packageEnv(targetFilePath)
+	if err != nil {
+		return nil, err
+	}
+	targetName := Label(target).Target()
+	env := append(append([]string{}, w.config.Env...), envVars...)
+	if p := providerFor(targetFilePath); p != nil {
+		command, providerEnv := p.Command(&Invocation{
+			Label:     target,
+			Dir:       filepath.Dir(targetFilePath),
+			BuildFile: targetFilePath,
+			Makefile:  runnablePath,
+			Provider:  p,
+			Target:    targetName,
+			Args:      makeArgs,
+		})
+		return &DryRun{
+			Label:   target,
+			Command: command,
+			Dir:     filepath.Dir(targetFilePath),
+			Env:     append(env, providerEnv...),
+		}, nil
+	}
+
+	makefilePath, stdin := runnablePath, ""
+	if runnablePath != targetFilePath {
+		// the runnable copy isn't written, so make reads its source from stdin
+		makefilePath, stdin = "-", src
+	}
+	args := makeCommandArgs(targetFilePath, makefilePath, targetName, makeArgs)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, w.config.Make, append([]string{"-n"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(append(append(cmd.Env, w.config.Env...), os.Environ()...), envVars...)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("expand %s with %s -n: %w: %s", target, w.config.Make, err, strings.TrimSpace(stderr.String()))
+	}
+
+	run := &DryRun{
+		Label:   target,
+		Command: append([]string{w.config.Make}, args...),
+		Stdin:   stdin,
+		Dir:     dir,
+		Env:     env,
+		Recipe:  stdout.String(),
+	}
+	image, err := getImage(targetFilePath, targetName)
+	if err != nil {
+		return nil, err
+	}
+	if image != "" {
+		c, err := w.makeContainer(image, args, env)
+		if err != nil {
+			return nil, err
+		}
+		run.Image, run.Command, run.Dir, run.Env = image, c.Command, c.Dir, c.Env
+	}
+	return run, nil
+}
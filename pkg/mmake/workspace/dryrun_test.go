@@ -0,0 +1,65 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWorkspace_DryRunTargets(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":  "build: //auth:build\n\techo build $(MM_PATH) $(V)\n",
+		"auth/Makefile": "build:\n\t@echo auth\n",
+	})
+	w.SetReadOnly(true)
+
+	runs, err := w.DryRunTargets(context.Background(), []string{"V=1"}, "//api:build")
+	if err != nil {
+		t.Fatalf("Workspace.DryRunTargets() error = %v", err)
+	}
+	var labels []string
+	for _, r := range runs {
+		labels = append(labels, r.Label)
+	}
+	if want := []string{"//auth:build", "//api:build"}; !reflect.DeepEqual(labels, want) {
+		t.Fatalf("Workspace.DryRunTargets() labels = %v, want %v", labels, want)
+	}
+
+	if auth := runs[0]; contains(auth.Command, "V=1") {
+		t.Errorf("DryRun.Command = %v, want the arguments only for the requested target", auth.Command)
+	}
+	api := runs[1]
+	// the copy without the label prerequisites isn't written, so the command
+	// reads it from stdin
+	wantCommand := []string{"make", "-f", "-", "MMAKE_MAKEFILE=" + filepath.Join(w.rootPath, "api", "Makefile"), "V=1", "build"}
+	if !reflect.DeepEqual(api.Command, wantCommand) {
+		t.Errorf("DryRun.Command = %v, want %v", api.Command, wantCommand)
+	}
+	if !strings.HasSuffix(api.Stdin, "build:\n\techo build $(MM_PATH) $(V)\n") {
+		t.Errorf("DryRun.Stdin = %q, want the Makefile without the label prerequisites", api.Stdin)
+	}
+	if auth := runs[0]; auth.Stdin != "" || auth.Command[2] != filepath.Join(w.rootPath, "auth", "Makefile") {
+		t.Errorf("DryRun = %+v, want the Makefile itself", auth)
+	}
+	if want := "echo build " + filepath.Join(w.rootPath, "api") + " 1\n"; api.Recipe != want {
+		t.Errorf("DryRun.Recipe = %q, want %q", api.Recipe, want)
+	}
+	if want := "MM_OUT_PATH=" + filepath.Join(w.buildRoot(), "api"); !contains(api.Env, want) {
+		t.Errorf("DryRun.Env = %v, want it to contain %s", api.Env, want)
+	}
+	if _, err := os.Stat(w.buildRoot()); !os.IsNotExist(err) {
+		t.Errorf("the build directory was created in a dry run")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
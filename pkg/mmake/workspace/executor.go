@@ -0,0 +1,132 @@
+package workspace
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Invocation is a single run of a target, carried out by an Executor.
+type Invocation struct {
+	// Label is the label of the target, e.g. //services/api:build
+	Label string
+	// Dir is the package directory
+	Dir string
+	// BuildFile is the path to the package's build file
+	BuildFile string
+	// Provider is the provider of the build file, or nil if it is a Makefile.
+	// Its Command runs the target instead of make.
+	Provider Provider
+	// Makefile is the path to the build file to run. It is a copy of the
+	// build file without the label prerequisites if it has any, which mmake
+	// runs itself beforehand.
+	Makefile string
+	// Target is the name of the target in the build file, it is empty for
+	// the default target
+	Target string
+	// Args are the variables and flags to pass to make, or to the tool of
+	// the provider, e.g. VAR=value
+	Args []string
+	// DefaultEnv are the env defaults from the configuration, which the
+	// calling environment overrides
+	DefaultEnv []string
+	// Env are the MM_ variables, which override everything else
+	Env []string
+	// Image is the container image the target should run in, if any
+	Image string
+	// ProcessGroup asks for every process the target started to be stopped
+	// when ctx is done, not only the first one
+	ProcessGroup bool
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Executor runs targets. A target failing should be reported with an
+// *exec.ExitError or an *ErrCommand, or an error wrapping one, so that it
+// isn't mistaken for mmake failing to run the target.
+type Executor interface {
+	// Execute runs the invocation until it finishes or ctx is done.
+	Execute(ctx context.Context, inv *Invocation) error
+}
+
+// ExecutorFunc adapts a function to an Executor.
+type ExecutorFunc func(ctx context.Context, inv *Invocation) error
+
+// Execute calls f.
+func (f ExecutorFunc) Execute(ctx context.Context, inv *Invocation) error {
+	return f(ctx, inv)
+}
+
+// MakeExecutor runs targets on the host with GNU make, or with the command of
+// the build file's provider. It ignores the image.
+type MakeExecutor struct {
+	// Make is the make binary, defaults to make
+	Make string
+}
+
+// Execute runs make with the invocation's build file, arguments and target.
+func (e *MakeExecutor) Execute(ctx context.Context, inv *Invocation) error {
+	bin := e.Make
+	if bin == "" {
+		bin = "make"
+	}
+	args := append([]string{bin}, makeCommandArgs(inv.BuildFile, inv.Makefile, inv.Target, inv.Args)...)
+	var providerEnv []string
+	if inv.Provider != nil {
+		args, providerEnv = inv.Provider.Command(inv)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if inv.Provider != nil {
+		cmd.Dir = inv.Dir
+	}
+	cmd.Stdout = inv.Stdout
+	cmd.Stderr = inv.Stderr
+	cmd.Stdin = inv.Stdin
+
+	// config defaults come first so that the calling environment can override them
+	cmd.Env = append(cmd.Env, inv.DefaultEnv...)
+	cmd.Env = append(cmd.Env, os.Environ()...)
+	cmd.Env = append(cmd.Env, inv.Env...)
+	cmd.Env = append(cmd.Env, providerEnv...)
+	if inv.ProcessGroup {
+		setProcessGroup(cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if inv.ProcessGroup {
+		// exec only kills make itself when ctx is done
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				killProcessGroup(cmd)
+			case <-stop:
+			}
+		}()
+	}
+	return cmd.Wait()
+}
+
+// SetExecutor sets the executor that runs every target. By default targets
+// run with GNU make or the tool of their provider, inside a container if they
+// have an image.
+func (w *Workspace) SetExecutor(e Executor) {
+	w.executor = e
+}
+
+// execute runs the invocation with the executor, or the default one.
+func (w *Workspace) execute(ctx context.Context, inv *Invocation) error {
+	switch {
+	case w.executor != nil:
+		return w.executor.Execute(ctx, inv)
+	case inv.Image != "":
+		return w.runInContainer(ctx, inv)
+	default:
+		return (&MakeExecutor{Make: w.config.Make}).Execute(ctx, inv)
+	}
+}
@@ -0,0 +1,90 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWorkspace_SetExecutor(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile": "build: //lib:build\n\tgo build\n",
+		"lib/Makefile": "# mmake:image golang:1.22\nbuild:\n\tgo build\n",
+	})
+	var invocations []*Invocation
+	w.SetExecutor(ExecutorFunc(func(ctx context.Context, inv *Invocation) error {
+		invocations = append(invocations, inv)
+		fmt.Fprintf(inv.Stdout, "%s\n", inv.Label)
+		return nil
+	}))
+
+	var out bytes.Buffer
+	opts := RunOptions{Stdout: &out, MakeArgs: []string{"V=1"}}
+	if _, err := w.RunTargets(context.Background(), opts, "//api:build"); err != nil {
+		t.Fatalf("Workspace.RunTargets() error = %v", err)
+	}
+	if want := "//lib:build\n//api:build\n"; out.String() != want {
+		t.Errorf("Workspace.RunTargets() printed %q, want %q", out.String(), want)
+	}
+
+	lib, api := invocations[0], invocations[1]
+	if lib.Image != "golang:1.22" || api.Image != "" {
+		t.Errorf("Invocation.Image = %q, %q, want golang:1.22 and none", lib.Image, api.Image)
+	}
+	if want := filepath.Join(w.buildRoot(), ".mmake", "api", "Makefile"); api.Makefile != want {
+		t.Errorf("Invocation.Makefile = %s, want the copy without label prerequisites %s", api.Makefile, want)
+	}
+	if want := filepath.Join(w.rootPath, "api", "Makefile"); api.BuildFile != want {
+		t.Errorf("Invocation.BuildFile = %s, want %s", api.BuildFile, want)
+	}
+	if api.Target != "build" || !reflect.DeepEqual(api.Args, []string{"V=1"}) {
+		t.Errorf("Invocation target and args = %s %v, want build [V=1]", api.Target, api.Args)
+	}
+}
+
+func TestWorkspace_SetExecutor_errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCommand bool
+	}{
+		{name: "target failed", err: &ErrCommand{errors.New("exit status 2")}, wantCommand: true},
+		{name: "couldn't run", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := writeWorkspace(t, map[string]string{"api/Makefile": "build:\n"})
+			w.SetExecutor(ExecutorFunc(func(ctx context.Context, inv *Invocation) error {
+				return tt.err
+			}))
+			_, _, err := w.runTarget(context.Background(), "//api:build", RunOptions{}, nil, nil, nil, nil)
+			var cmdErr *ErrCommand
+			if errors.As(err, &cmdErr) != tt.wantCommand {
+				t.Errorf("Workspace.runTarget() error = %v, want a command error %v", err, tt.wantCommand)
+			}
+		})
+	}
+}
+
+func TestMakeExecutor(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{"api/Makefile": "build:\n\t@echo $(MM_PATH) $(V) $(DEFAULT)\n"})
+	var out bytes.Buffer
+	err := (&MakeExecutor{}).Execute(context.Background(), &Invocation{
+		Makefile:   filepath.Join(w.rootPath, "api", "Makefile"),
+		Target:     "build",
+		Args:       []string{"V=1"},
+		DefaultEnv: []string{"DEFAULT=d"},
+		Env:        []string{"MM_PATH=/api"},
+		Stdout:     &out,
+	})
+	if err != nil {
+		t.Fatalf("MakeExecutor.Execute() error = %v", err)
+	}
+	if want := "/api 1 d\n"; out.String() != want {
+		t.Errorf("MakeExecutor.Execute() printed %q, want %q", out.String(), want)
+	}
+}
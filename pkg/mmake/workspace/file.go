@@ -10,10 +10,6 @@ import (
 	"github.com/aakarim/mmake/internal/makefile"
 )
 
-type Label string
-
-const RootLabel = "//"
-
 type BuildFile struct {
 	// path to the build file
 	Path string
@@ -23,6 +19,18 @@ type BuildFile struct {
 	Targets []string
 	// the description of the build file (if any)
 	Description string
+	// TargetDescriptions are the comments at the start of each target's
+	// recipe, keyed by target name. Targets without one are left out.
+	TargetDescriptions map[string]string
+	// Tool is the tool that runs the build file, make or the name of its
+	// Provider
+	Tool string
+	// discovered are the targets that make reported, if they were discovered
+	// with DiscoverMake
+	discovered []*makefile.Target
+	// includes are the paths of the files the Makefile includes, directly or
+	// through other included files
+	includes []string
 }
 
 func (b *BuildFile) HasTarget(name string) bool {
@@ -34,22 +42,59 @@ func (b *BuildFile) HasTarget(name string) bool {
 	return false
 }
 
+// target returns the discovered target with the given name, or nil if the
+// targets were not discovered with make.
+func (b *BuildFile) target(name string) *makefile.Target {
+	for _, t := range b.discovered {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// describeTargets sets the descriptions of the targets, using lookup to
+// find each target.
+func (b *BuildFile) describeTargets(lookup func(name string) *makefile.Target) {
+	b.TargetDescriptions = nil
+	for _, name := range b.Targets {
+		t := lookup(name)
+		if t == nil {
+			continue
+		}
+		if desc := describeTarget(t); desc != "" {
+			if b.TargetDescriptions == nil {
+				b.TargetDescriptions = map[string]string{}
+			}
+			b.TargetDescriptions[name] = desc
+		}
+	}
+}
+
 func CreateBuildFile(path, label string, w io.Writer) (*BuildFile, error) {
 	return &BuildFile{
 		Path:  path,
 		Label: Label(label),
+		Tool:  "make",
 	}, nil
 }
 
+// FileIsBuildFile returns true if the file is a Makefile or a build file of a
+// Provider.
 func FileIsBuildFile(path string) bool {
-	if f := filepath.Base(path); strings.HasSuffix(f, "makefile") ||
-		strings.HasSuffix(f, "Makefile") {
-		return true
-	}
-	return false
+	return buildFileRank(filepath.Base(path)) >= 0
+}
+
+// isMakefile returns true if the file name is a Makefile's.
+func isMakefile(name string) bool {
+	return strings.HasSuffix(name, "makefile") || strings.HasSuffix(name, "Makefile")
 }
 
 func ParseBuildFile(path string, rootDir string) (*BuildFile, error) {
+	if p := providerFor(path); p != nil {
+		return parseProviderFile(p, path, rootDir)
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -62,18 +107,16 @@ func ParseBuildFile(path string, rootDir string) (*BuildFile, error) {
 	}
 
 	var desc string
-	// if the first character is a #, then this is a description
+	// if the first character is a #, then the first line is a description
 	if len(str) > 0 && str[0] == '#' {
-		// find the first newline
-		for i, c := range str {
-			if c == '\n' {
-				desc = string(str[:i])
-				break
-			}
+		firstLine, _, _ := strings.Cut(string(str), "\n")
+		if !isAnnotation(firstLine) {
+			desc = strings.TrimSpace(strings.TrimPrefix(firstLine, "#"))
 		}
 	}
 
-	mf, err := makefile.ParseMakefile(strings.NewReader(string(str)))
+	// parse from disk so that targets in included files are found too
+	mf, err := makefile.ParseFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -83,16 +126,41 @@ func ParseBuildFile(path string, rootDir string) (*BuildFile, error) {
 	}
 
 	// parse as makefile
-	return &BuildFile{
+	bf := &BuildFile{
 		Path:  path,
 		Label: Label(label),
 		Targets: func() []string {
 			var targets []string
-			targets = append(targets, mf.Targets...)
+			targets = append(targets, mf.Targets()...)
 			return targets
 		}(),
 		Description: desc,
-	}, nil
+		Tool:        "make",
+	}
+	mf.Walk(func(n makefile.Node) {
+		if inc, ok := n.(*makefile.Include); ok {
+			for _, f := range inc.Files {
+				bf.includes = append(bf.includes, f.Path)
+			}
+		}
+	})
+	bf.describeTargets(mf.Target)
+	return bf, nil
+}
+
+// parseProviderFile parses a build file that isn't a Makefile with its
+// provider.
+func parseProviderFile(p Provider, path, rootDir string) (*BuildFile, error) {
+	label, err := GetPackageFromFile(path, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	bf, err := p.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	bf.Path, bf.Label, bf.Tool = path, Label(label), p.Name()
+	return bf, nil
 }
 
 // CreateTarget creates a new target in the build file
@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores for fuzzy matching.
+const (
+	// fuzzyMatchScore is given for every matched character
+	fuzzyMatchScore = 1
+	// fuzzyConsecutiveBonus is given when a match follows the previous one
+	fuzzyConsecutiveBonus = 5
+	// fuzzyBoundaryBonus is given for a match at the start of a word,
+	// e.g. the a of api in //services/api
+	fuzzyBoundaryBonus = 8
+	// fuzzyTargetBonus is given for a match at the start of the target name
+	fuzzyTargetBonus = 4
+	// fuzzyGapPenalty is taken for every character skipped between matches
+	fuzzyGapPenalty = 1
+)
+
+// FuzzyMatch is a target that matches a fuzzy pattern.
+type FuzzyMatch struct {
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+	// Score is higher for better matches
+	Score int `json:"score"`
+}
+
+// Find returns the targets in the files found by the last Update whose
+// labels match every word of the pattern, best match first. A word matches
+// if its characters appear in the label in order, e.g. `api dep` matches
+// //services/api:deploy. Matching ignores case.
+func (q *Query) Find(pattern string) []*FuzzyMatch {
+	words := strings.Fields(strings.ToLower(pattern))
+	var matches []*FuzzyMatch
+	for _, f := range q.files {
+		for _, t := range f.Targets {
+			label := TargetLabel(f.Label, t)
+			score, ok := fuzzyScoreWords(words, label)
+			if !ok {
+				continue
+			}
+			desc, _, _ := strings.Cut(f.TargetDescriptions[t], "\n")
+			matches = append(matches, &FuzzyMatch{Label: label, Description: desc, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		// prefer shorter labels, then sort alphabetically
+		if len(matches[i].Label) != len(matches[j].Label) {
+			return len(matches[i].Label) < len(matches[j].Label)
+		}
+		return matches[i].Label < matches[j].Label
+	})
+	return matches
+}
+
+// fuzzyScoreWords returns the sum of the scores of every word, or false if
+// any of them doesn't match.
+func fuzzyScoreWords(words []string, label string) (int, bool) {
+	var total int
+	lower := strings.ToLower(label)
+	for _, w := range words {
+		score, ok := fuzzyScore(w, lower)
+		if !ok {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+// fuzzyScore returns the score of the best match of pattern as a subsequence
+// of s, or false if it doesn't match. Both must already be lower case.
+func fuzzyScore(pattern, s string) (int, bool) {
+	p := []rune(pattern)
+	r := []rune(s)
+	if len(p) == 0 {
+		return 0, true
+	}
+	targetStart := strings.LastIndex(s, ":") + 1
+
+	best, found := 0, false
+	// try every start of the match and greedily match the rest
+	for start := range r {
+		if r[start] != p[0] {
+			continue
+		}
+		score, pi, prev := 0, 0, -1
+		for i := start; i < len(r) && pi < len(p); i++ {
+			if r[i] != p[pi] {
+				continue
+			}
+			score += fuzzyMatchScore
+			if prev >= 0 {
+				if i == prev+1 {
+					score += fuzzyConsecutiveBonus
+				} else {
+					score -= (i - prev - 1) * fuzzyGapPenalty
+				}
+			}
+			if i == 0 || isWordBoundary(r[i-1]) {
+				score += fuzzyBoundaryBonus
+			}
+			if i == targetStart {
+				score += fuzzyTargetBonus
+			}
+			prev = i
+			pi++
+		}
+		if pi == len(p) && (!found || score > best) {
+			best, found = score, true
+		}
+	}
+	return best, found
+}
+
+func isWordBoundary(r rune) bool {
+	return r == '/' || r == ':' || r == '-' || r == '_' || r == '.' || unicode.IsSpace(r)
+}
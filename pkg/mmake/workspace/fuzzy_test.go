@@ -0,0 +1,47 @@
+package workspace
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestQuery_Find(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"Makefile":               "deploy-all:\n",
+		"services/api/Makefile":  "deploy:\n\t# Deploy the API\n\techo\ndev:\nbuild:\n",
+		"services/auth/Makefile": "deploy:\nbuild:\n",
+	})
+	q := NewQuery(w, RootLabel)
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "api dep", want: []string{"//services/api:deploy"}},
+		{pattern: "dep api", want: []string{"//services/api:deploy"}},
+		{pattern: "API DEP", want: []string{"//services/api:deploy"}},
+		{pattern: "auth b", want: []string{"//services/auth:build"}},
+		// the target name scores higher than a match inside the path
+		{pattern: "dep", want: []string{"//:deploy-all", "//services/api:deploy", "//services/auth:deploy"}},
+		{pattern: "nothing", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			var got []string
+			for _, m := range q.Find(tt.pattern) {
+				got = append(got, m.Label)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query.Find(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+
+	if got := q.Find("api dep")[0].Description; got != "Deploy the API" {
+		t.Errorf("description = %q, want %q", got, "Deploy the API")
+	}
+}
@@ -0,0 +1,203 @@
+package workspace
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MMakeIgnoreFile lists paths that mmake skips but git doesn't, with the same
+// syntax as .gitignore. Like .gitignore files, it can be put in any directory
+// and its patterns are relative to that directory.
+const MMakeIgnoreFile = ".mmakeignore"
+
+// ignoreFiles are read in every directory that is scanned, later files win.
+var ignoreFiles = []string{".gitignore", MMakeIgnoreFile}
+
+// ignorePattern is a single line of an ignore file.
+type ignorePattern struct {
+	// dir is the directory the pattern is relative to, relative to the
+	// workspace root with forward slashes, or empty for the root
+	dir string
+	// segments are the pattern split at slashes. Patterns without a slash
+	// match at any depth, so they start with **
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreRules are gitignore style patterns in the order they were read. The
+// last pattern matching a path decides whether it is ignored, so a negated
+// pattern can include a path again that an earlier pattern ignored.
+type ignoreRules []ignorePattern
+
+// parseIgnorePattern parses a line of an ignore file in dir. It returns false
+// for blank lines and comments.
+func parseIgnorePattern(line, dir string) (ignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are ignored unless they are escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{dir: dir}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// a slash at the start or in the middle anchors the pattern to dir
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignorePattern{}, false
+	}
+	if !anchored {
+		line = "**/" + line
+	}
+	// path.Match negates classes with ^ rather than !
+	line = strings.ReplaceAll(line, "[!", "[^")
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// ignored returns true if the path, relative to the workspace root with
+// forward slashes, is ignored.
+func (r ignoreRules) ignored(rel string, isDir bool) bool {
+	for i := len(r) - 1; i >= 0; i-- {
+		p := r[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if p.dir != "" {
+			if !strings.HasPrefix(rel, p.dir+"/") {
+				continue
+			}
+			sub = rel[len(p.dir)+1:]
+		}
+		if matchSegments(p.segments, strings.Split(sub, "/")) {
+			return !p.negate
+		}
+	}
+	return false
+}
+
+// matchSegments matches the path segments against the pattern segments. **
+// matches any number of segments, and at the end of a pattern at least one.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// baseIgnoreRules returns the patterns that apply to the whole workspace:
+// the ignore patterns of the configuration, the build directory and git's
+// info/exclude file.
+func (w *Workspace) baseIgnoreRules() ignoreRules {
+	var rules ignoreRules
+	for _, v := range w.ignoreDirs {
+		if p, ok := parseIgnorePattern(v, ""); ok {
+			rules = append(rules, p)
+		}
+	}
+	rules, _ = readIgnoreFile(rules, filepath.Join(w.rootPath, ".git", "info", "exclude"), "")
+	return rules
+}
+
+// withIgnoreFiles returns the rules with the patterns of the ignore files in
+// dir added after them. The rules passed in are not modified.
+func (w *Workspace) withIgnoreFiles(rules ignoreRules, dir string) (ignoreRules, error) {
+	rel := w.relPath(dir)
+	if rel == "." {
+		rel = ""
+	}
+	// never append to the parent's rules in place, its other children share them
+	rules = rules[:len(rules):len(rules)]
+	for _, name := range ignoreFiles {
+		var err error
+		if rules, err = readIgnoreFile(rules, filepath.Join(dir, name), rel); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// readIgnoreFile adds the patterns of the ignore file at p, which are relative
+// to dir, to the rules. A missing file adds nothing.
+func readIgnoreFile(rules ignoreRules, p, dir string) (ignoreRules, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pattern, ok := parseIgnorePattern(scanner.Text(), dir); ok {
+			rules = append(rules, pattern)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ignoreRulesAbove returns the rules that decide whether dir is ignored: the
+// base rules and those of the ignore files in the directories from the root
+// down to the parent of dir.
+func (w *Workspace) ignoreRulesAbove(dir string) (ignoreRules, error) {
+	rules := w.baseIgnoreRules()
+	rel := w.relPath(dir)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return rules, nil
+	}
+	parent := w.rootPath
+	for _, segment := range strings.Split(rel, "/") {
+		var err error
+		if rules, err = w.withIgnoreFiles(rules, parent); err != nil {
+			return nil, err
+		}
+		parent = filepath.Join(parent, segment)
+	}
+	return rules, nil
+}
+
+// isIgnored returns true if the path in the workspace is ignored by the rules.
+// The workspace root is never ignored.
+func (w *Workspace) isIgnored(rules ignoreRules, p string, isDir bool) bool {
+	rel := w.relPath(p)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	return rules.ignored(rel, isDir)
+}
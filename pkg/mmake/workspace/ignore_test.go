@@ -0,0 +1,85 @@
+package workspace
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIgnoreRules_ignored(t *testing.T) {
+	tests := []struct {
+		name  string
+		dir   string
+		lines []string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{name: "name at any depth", lines: []string{"dist"}, path: "web/app/dist", isDir: true, want: true},
+		{name: "glob", lines: []string{"bazel-*"}, path: "bazel-out", isDir: true, want: true},
+		{name: "no match", lines: []string{"dist"}, path: "web/distribution", isDir: true},
+		{name: "anchored", lines: []string{"/generated"}, path: "generated", isDir: true, want: true},
+		{name: "anchored below the root", lines: []string{"/generated"}, path: "api/generated", isDir: true},
+		{name: "middle slash anchors", lines: []string{"api/gen"}, path: "x/api/gen", isDir: true},
+		{name: "middle slash", lines: []string{"api/gen"}, path: "api/gen", isDir: true, want: true},
+		{name: "directory only", lines: []string{"out/"}, path: "out", isDir: false},
+		{name: "directory only matches directory", lines: []string{"out/"}, path: "out", isDir: true, want: true},
+		{name: "double star", lines: []string{"a/**/b"}, path: "a/x/y/b", isDir: true, want: true},
+		{name: "double star matches nothing", lines: []string{"a/**/b"}, path: "a/b", isDir: true, want: true},
+		{name: "trailing double star", lines: []string{"a/**"}, path: "a", isDir: true},
+		{name: "trailing double star inside", lines: []string{"a/**"}, path: "a/b", isDir: true, want: true},
+		{name: "negation", lines: []string{"*.venv", "!keep.venv"}, path: "keep.venv", isDir: true},
+		{name: "last match wins", lines: []string{"!keep", "keep"}, path: "keep", isDir: true, want: true},
+		{name: "comment", lines: []string{"# dist"}, path: "# dist", isDir: true},
+		{name: "escaped hash", lines: []string{`\#dist`}, path: "#dist", isDir: true, want: true},
+		{name: "negated class", lines: []string{"[!a]b"}, path: "cb", isDir: true, want: true},
+		{name: "relative to its directory", dir: "web", lines: []string{"/dist"}, path: "web/dist", isDir: true, want: true},
+		{name: "outside of its directory", dir: "web", lines: []string{"dist"}, path: "api/dist", isDir: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules ignoreRules
+			for _, l := range tt.lines {
+				if p, ok := parseIgnorePattern(l, tt.dir); ok {
+					rules = append(rules, p)
+				}
+			}
+			if got := rules.ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("ignoreRules.ignored(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery_Update_ignore(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		".gitignore":                  "dist/\n/generated\n",
+		".mmakeignore":                "legacy\n",
+		"api/Makefile":                "build:\n",
+		"api/dist/Makefile":           "build:\n",
+		"api/.gitignore":              "*/\n!keep/\n",
+		"api/keep/Makefile":           "build:\n",
+		"api/tmp/Makefile":            "build:\n",
+		"generated/Makefile":          "build:\n",
+		"web/generated/Makefile":      "build:\n",
+		"web/legacy/Makefile":         "build:\n",
+		"bazel-out/Makefile":          "build:\n",
+		"services/.venv/lib/Makefile": "build:\n",
+	})
+	w.ignoreDirs = append(w.ignoreDirs, "bazel-*", "services/.venv")
+
+	q := NewQuery(w, RootLabel)
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	var got []string
+	for _, f := range q.Files() {
+		got = append(got, string(f.Label))
+	}
+	sort.Strings(got)
+	want := []string{"//api", "//api/keep", "//web/generated"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query.Update() packages = %v, want %v", got, want)
+	}
+}
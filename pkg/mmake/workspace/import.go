@@ -21,17 +21,46 @@ func (e *ErrTargetExists) Error() string {
 // e.g. mmake //services/api:api -- go run ./services/api
 // will return true.
 func HasCommandToImport(args []string) bool {
-	j := strings.Join(args, " ")
-	return strings.Contains(j, " -- ")
+	return importSeparatorIndex(args) >= 0
 }
 
+// GetImportedCommand returns the words after the `--` in args as a command.
 func GetImportedCommand(args []string) string {
-	j := strings.Join(args, " ")
-	spl := strings.Split(j, " -- ")
-	return spl[1]
+	i := importSeparatorIndex(args)
+	if i < 0 {
+		return ""
+	}
+	return strings.Join(args[i+1:], " ")
+}
+
+// importSeparatorIndex returns the index of the first `--` in args, or -1.
+// Only a whole argument counts, so that `--` inside a make variable such as
+// ARGS="-- -v" isn't mistaken for a command to import.
+func importSeparatorIndex(args []string) int {
+	for i, a := range args {
+		if a == "--" {
+			return i
+		}
+	}
+	return -1
 }
 
+// Import imports the command after the `--` in args as the target and runs it.
 func (w *Workspace) Import(ctx context.Context, target string, args []string) error {
+	if err := w.ImportTarget(ctx, target, args); err != nil {
+		return err
+	}
+
+	// run the target
+	if err := w.RunTarget(ctx, target); err != nil {
+		return fmt.Errorf("run target: %w", err)
+	}
+	return nil
+}
+
+// ImportTarget imports the command after the `--` in args as the target
+// without running it. If the package has no build file then one is created.
+func (w *Workspace) ImportTarget(ctx context.Context, target string, args []string) error {
 	// first check if there is a build file at the target
 	targetFilePath, err := w.getBuildFile(ctx, target)
 	if err != nil && !errors.Is(err, ErrNoMakefileFound) {
@@ -40,11 +69,15 @@ func (w *Workspace) Import(ctx context.Context, target string, args []string) er
 		}
 		return fmt.Errorf("get build file: %w", err)
 	}
+	if err == nil && providerFor(targetFilePath) != nil {
+		// a new Makefile would take over the package from the existing build file
+		return fmt.Errorf("can't import into %s, commands can only be imported into Makefiles", filepath.Base(targetFilePath))
+	}
 	// if no build file create
 	if errors.Is(err, ErrNoMakefileFound) {
 		// create a build file
 		targetFilePath = filepath.Join(w.rootPath,
-			getRelPathFromTarget(target), "Makefile")
+			Label(target).Path(), "Makefile")
 
 	}
 
@@ -61,14 +94,14 @@ func (w *Workspace) Import(ctx context.Context, target string, args []string) er
 		if err != nil {
 			return fmt.Errorf("create build file: %w", err)
 		}
-		bf, err = CreateBuildFile(targetFilePath, getPackageName(target), f)
+		bf, err = CreateBuildFile(targetFilePath, string(Label(target).Package()), f)
 		if err != nil {
 			return fmt.Errorf("create build file: %w", err)
 		}
 		f.Close()
 	}
 
-	targetName := getTargetName(target)
+	targetName := Label(target).Target()
 	var hasTarget bool
 	if bf != nil {
 		hasTarget = bf.HasTarget(targetName)
@@ -90,11 +123,6 @@ func (w *Workspace) Import(ctx context.Context, target string, args []string) er
 		strings.NewReader(transformedCommand)); err != nil {
 		return fmt.Errorf("create target: %w", err)
 	}
-
-	// run the target
-	if err := w.RunTarget(ctx, target); err != nil {
-		return fmt.Errorf("run target: %w", err)
-	}
 	return nil
 }
 
@@ -0,0 +1,303 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/aakarim/mmake/internal/makefile"
+)
+
+// indexVersion is bumped when the index format changes so old indexes are
+// thrown away.
+const indexVersion = 5
+
+// index is the on-disk record of the directories and build files found by
+// the last scan. A directory is only read again if its modification time
+// changed, and a build file is only parsed again if it changed.
+type index struct {
+	Version int `json:"version"`
+	// Ignore and Discover are the settings the index was built with
+	Ignore   []string `json:"ignore"`
+	Discover string   `json:"discover"`
+	// Dirs are keyed by their path relative to the workspace root
+	Dirs map[string]*indexDir `json:"dirs"`
+	// Files are keyed by their path relative to the workspace root
+	Files map[string]*indexFile `json:"files"`
+
+	dirty bool
+}
+
+type indexDir struct {
+	ModTime int64 `json:"mod_time"`
+	// Entries are the directories and the build file in the directory, in
+	// lexical order. Ignored directories are included since whether they
+	// are ignored depends on the ignore files, which aren't indexed
+	Entries []indexEntry `json:"entries"`
+}
+
+type indexEntry struct {
+	Name string `json:"name"`
+	Dir  bool   `json:"dir,omitempty"`
+}
+
+type indexFile struct {
+	ModTime     int64    `json:"mod_time"`
+	Size        int64    `json:"size"`
+	Targets     []string `json:"targets"`
+	Description string   `json:"description,omitempty"`
+	Tool        string   `json:"tool"`
+	// TargetDescriptions are keyed by target name
+	TargetDescriptions map[string]string  `json:"target_descriptions,omitempty"`
+	Discovered         []*makefile.Target `json:"discovered,omitempty"`
+	// Includes are the modification times of the included files, keyed by
+	// their path. The targets can change with them
+	Includes map[string]int64 `json:"includes,omitempty"`
+	// DiscoverDir is the working directory make discovered the targets in,
+	// relative includes are resolved from it
+	DiscoverDir string `json:"discover_dir,omitempty"`
+}
+
+// includesChanged returns true if any of the included files changed or was
+// removed since the file was indexed.
+func (f *indexFile) includesChanged() bool {
+	return modTimesChanged(f.Includes)
+}
+
+// modTimes returns the modification times of the files, keyed by their path,
+// or nil if there are none.
+func modTimes(paths []string) (map[string]int64, error) {
+	var times map[string]int64
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if times == nil {
+			times = map[string]int64{}
+		}
+		times[p] = info.ModTime().UnixNano()
+	}
+	return times, nil
+}
+
+// modTimesChanged returns true if any of the files changed or was removed
+// since their modification times were recorded.
+func modTimesChanged(times map[string]int64) bool {
+	for p, modTime := range times {
+		info, err := os.Stat(p)
+		if err != nil || info.ModTime().UnixNano() != modTime {
+			return true
+		}
+	}
+	return false
+}
+
+// indexPath returns where the index is stored.
+func (w *Workspace) indexPath() string {
+	return filepath.Join(w.buildRoot(), ".mmake", "index.json")
+}
+
+// loadIndex reads the index, or returns an empty one if there is no index or
+// it was built with different settings.
+func (w *Workspace) loadIndex() *index {
+	idx := &index{
+		Version:  indexVersion,
+		Ignore:   w.ignoreDirs,
+		Discover: w.config.Discover,
+		Dirs:     map[string]*indexDir{},
+		Files:    map[string]*indexFile{},
+	}
+	b, err := os.ReadFile(w.indexPath())
+	if err != nil {
+		return idx
+	}
+	var saved index
+	if err := json.Unmarshal(b, &saved); err != nil ||
+		saved.Version != idx.Version ||
+		!reflect.DeepEqual(saved.Ignore, idx.Ignore) ||
+		saved.Discover != idx.Discover ||
+		saved.Dirs == nil || saved.Files == nil {
+		return idx
+	}
+	return &saved
+}
+
+// saveIndex writes the index if it changed. The index only makes scanning
+// faster, so failing to write it is not an error.
+func (w *Workspace) saveIndex(idx *index) {
+	if !idx.dirty || w.readOnly {
+		return
+	}
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return
+	}
+	p := w.indexPath()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), "index.json.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err != nil || closeErr != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), p)
+}
+
+// entries returns the directories and the build file in dir, reading the
+// directory only if it changed since it was indexed. If the directory has
+// more than one build file then only the preferred one is its build file.
+func (idx *index) entries(w *Workspace, dir string) ([]indexEntry, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	rel := w.relPath(dir)
+	if d, ok := idx.Dirs[rel]; ok && d.ModTime == info.ModTime().UnixNano() {
+		return d.Entries, nil
+	}
+
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	buildFile := preferredBuildFile(des)
+	var entries []indexEntry
+	for _, de := range des {
+		switch {
+		case de.IsDir():
+			entries = append(entries, indexEntry{Name: de.Name(), Dir: true})
+		case de.Name() == buildFile:
+			entries = append(entries, indexEntry{Name: de.Name()})
+		}
+	}
+
+	// forget directories and files that no longer exist
+	if old, ok := idx.Dirs[rel]; ok {
+		for _, e := range old.Entries {
+			if !containsEntry(entries, e) {
+				idx.forget(path.Join(rel, e.Name))
+			}
+		}
+	}
+	idx.Dirs[rel] = &indexDir{ModTime: info.ModTime().UnixNano(), Entries: entries}
+	idx.dirty = true
+	return entries, nil
+}
+
+// buildFile returns the build file at p, parsing it only if it changed since
+// it was indexed.
+func (idx *index) buildFile(ctx context.Context, w *Workspace, p string) (*BuildFile, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	label, err := GetPackageFromFile(p, w.rootPath)
+	if err != nil {
+		return nil, err
+	}
+	var discoverDir string
+	if w.config.Discover == DiscoverMake && providerFor(p) == nil {
+		if discoverDir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	rel := w.relPath(p)
+	if f, ok := idx.Files[rel]; ok && f.ModTime == info.ModTime().UnixNano() && f.Size == info.Size() &&
+		f.DiscoverDir == discoverDir && !f.includesChanged() {
+		return &BuildFile{
+			Path:               p,
+			Label:              Label(label),
+			Targets:            f.Targets,
+			Description:        f.Description,
+			TargetDescriptions: f.TargetDescriptions,
+			Tool:               f.Tool,
+			discovered:         f.Discovered,
+		}, nil
+	}
+
+	bf, err := ParseBuildFile(p, w.rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse build file %s: %w", p, err)
+	}
+	if w.config.Discover == DiscoverMake && bf.Tool == "make" {
+		targets, makefiles, err := w.discoverTargets(ctx, bf.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover targets in %s: %w", p, err)
+		}
+		// make also finds includes that the parser skips
+		bf.includes = nil
+		for _, m := range makefiles {
+			if m != bf.Path {
+				bf.includes = append(bf.includes, m)
+			}
+		}
+		bf.discovered = targets
+		bf.Targets = nil
+		for _, t := range targets {
+			bf.Targets = append(bf.Targets, t.Name)
+		}
+		bf.describeTargets(bf.target)
+	}
+	includes, err := modTimes(bf.includes)
+	if err != nil {
+		return nil, err
+	}
+	idx.Files[rel] = &indexFile{
+		ModTime:            info.ModTime().UnixNano(),
+		Size:               info.Size(),
+		Targets:            bf.Targets,
+		Description:        bf.Description,
+		TargetDescriptions: bf.TargetDescriptions,
+		Tool:               bf.Tool,
+		Discovered:         bf.discovered,
+		Includes:           includes,
+		DiscoverDir:        discoverDir,
+	}
+	idx.dirty = true
+	return bf, nil
+}
+
+// forget removes the directory or file at rel and everything below it.
+func (idx *index) forget(rel string) {
+	delete(idx.Files, rel)
+	delete(idx.Dirs, rel)
+	for k := range idx.Dirs {
+		if strings.HasPrefix(k, rel+"/") {
+			delete(idx.Dirs, k)
+		}
+	}
+	for k := range idx.Files {
+		if strings.HasPrefix(k, rel+"/") {
+			delete(idx.Files, k)
+		}
+	}
+}
+
+func containsEntry(entries []indexEntry, e indexEntry) bool {
+	for _, v := range entries {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+// relPath returns p relative to the workspace root, using forward slashes.
+func (w *Workspace) relPath(p string) string {
+	rel, err := filepath.Rel(w.rootPath, p)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,101 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuery_Update_Index(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"Makefile":               "hello:\n",
+		"services/api/Makefile":  "# API\nbuild:\n",
+		"services/auth/Makefile": "build:\n",
+		"services/lib/Makefile":  "include ../common.mk\n",
+		"services/common.mk":     "lint:\n",
+	})
+	ctx := context.Background()
+
+	labels := func() map[Label][]string {
+		t.Helper()
+		q := NewQuery(w, RootLabel)
+		if err := q.Update(ctx, 0); err != nil {
+			t.Fatalf("Query.Update() error = %v", err)
+		}
+		got := map[Label][]string{}
+		for _, f := range q.Files() {
+			got[f.Label] = f.Targets
+		}
+		return got
+	}
+	// bumps the modification time so that changes within the clock
+	// resolution are still noticed
+	touch := func(p string) {
+		t.Helper()
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(filepath.Join(w.rootPath, p), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[Label][]string{
+		"//":              {"hello"},
+		"//services/api":  {"build"},
+		"//services/auth": {"build"},
+		"//services/lib":  {"lint"},
+	}
+	if got := labels(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first scan = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(w.indexPath()); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+
+	// unchanged files come from the index
+	idx := w.loadIndex()
+	idx.Files["services/api/Makefile"].Targets = []string{"from-index"}
+	idx.dirty = true
+	w.saveIndex(idx)
+	want["//services/api"] = []string{"from-index"}
+	if got := labels(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("scan from index = %v, want %v", got, want)
+	}
+
+	// changed files are parsed again
+	if err := os.WriteFile(filepath.Join(w.rootPath, "services/api/Makefile"), []byte("build:\ntest:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	touch("services/api/Makefile")
+	want["//services/api"] = []string{"build", "test"}
+
+	// so are files whose includes changed
+	if err := os.WriteFile(filepath.Join(w.rootPath, "services/common.mk"), []byte("lint:\nfmt:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	touch("services/common.mk")
+	want["//services/lib"] = []string{"lint", "fmt"}
+
+	// new and removed packages are found by the directory modification times
+	if err := os.MkdirAll(filepath.Join(w.rootPath, "services/web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(w.rootPath, "services/web/Makefile"), []byte("serve:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(w.rootPath, "services/auth")); err != nil {
+		t.Fatal(err)
+	}
+	touch("services")
+	want["//services/web"] = []string{"serve"}
+	delete(want, "//services/auth")
+
+	if got := labels(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("incremental scan = %v, want %v", got, want)
+	}
+	if _, ok := w.loadIndex().Files["services/auth/Makefile"]; ok {
+		t.Errorf("removed package is still in the index")
+	}
+}
@@ -0,0 +1,178 @@
+package workspace
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Label names a package or a target in the workspace, e.g. //services/api
+// or //services/api:build. The root package is //.
+//
+// A label can also be relative to a package: :build is the build target of
+// that package and api:build is the build target of its api subpackage.
+// Relative labels are made absolute with Resolve.
+type Label string
+
+const RootLabel = "//"
+
+// ErrInvalidLabel is returned when a label can't be parsed.
+type ErrInvalidLabel struct {
+	Label  string
+	Reason string
+}
+
+func (e *ErrInvalidLabel) Error() string {
+	return fmt.Sprintf("invalid label %q: %s", e.Label, e.Reason)
+}
+
+// ParseLabel parses and validates a label. Absolute labels start with //,
+// relative labels must have a target, e.g. :build or api:build, so that
+// they can't be mistaken for a command.
+func ParseLabel(s string) (Label, error) {
+	invalid := func(reason string) (Label, error) {
+		return "", &ErrInvalidLabel{Label: s, Reason: reason}
+	}
+	if s == "" {
+		return invalid("label is empty")
+	}
+	if strings.ContainsAny(s, " \t\r\n") {
+		return invalid("labels can't contain whitespace")
+	}
+
+	pkg, target, hasTarget := strings.Cut(s, ":")
+	if hasTarget {
+		if target == "" {
+			return invalid("missing target name after ':'")
+		}
+		if strings.Contains(target, ":") {
+			return invalid("labels can only contain one ':'")
+		}
+	}
+
+	var pkgPath string
+	switch {
+	case strings.HasPrefix(pkg, RootLabel):
+		pkgPath = pkg[len(RootLabel):]
+	case strings.HasPrefix(pkg, "/"):
+		return invalid("absolute labels start with //")
+	case !hasTarget:
+		return invalid("relative labels need a target, e.g. :build")
+	default:
+		pkgPath = pkg
+	}
+	if pkgPath == "" {
+		return Label(s), nil
+	}
+	for _, seg := range strings.Split(pkgPath, "/") {
+		switch seg {
+		case "":
+			return invalid("package path has an empty segment")
+		case ".", "..":
+			return invalid(fmt.Sprintf("package path can't contain %q", seg))
+		}
+	}
+	return Label(s), nil
+}
+
+// IsRelative returns true if the label is relative to a package.
+func (l Label) IsRelative() bool {
+	return !strings.HasPrefix(string(l), RootLabel)
+}
+
+// Package returns the package part of the label, e.g. //services/api for
+// //services/api:build. It is the label itself for package labels and the
+// relative path, which can be empty, for relative labels.
+func (l Label) Package() Label {
+	pkg, _, _ := strings.Cut(string(l), ":")
+	return Label(pkg)
+}
+
+// Target returns the target part of the label, e.g. build for
+// //services/api:build, or an empty string for package labels.
+func (l Label) Target() string {
+	_, target, _ := strings.Cut(string(l), ":")
+	return target
+}
+
+// Path returns the directory of the label's package relative to the
+// workspace root, e.g. services/api for //services/api:build and an empty
+// string for the root package.
+func (l Label) Path() string {
+	return strings.TrimPrefix(string(l.Package()), RootLabel)
+}
+
+// Resolve returns the label made absolute against the package pkg. Labels
+// that are already absolute are returned as is.
+func (l Label) Resolve(pkg Label) Label {
+	if !l.IsRelative() {
+		return l
+	}
+	base := pkg.Package()
+	if rel := l.Package(); rel != "" {
+		if base == RootLabel {
+			base += rel
+		} else {
+			base += "/" + rel
+		}
+	}
+	if l.Target() == "" {
+		return base
+	}
+	return Label(TargetLabel(base, l.Target()))
+}
+
+// DirLabel returns the label of the package in the directory dir, e.g.
+// //services/api for <root>/services/api.
+func (w *Workspace) DirLabel(dir string) (Label, error) {
+	root, err := realPath(w.rootPath)
+	if err != nil {
+		return "", err
+	}
+	dir, err = realPath(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return RootLabel, nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the workspace %s", dir, root)
+	}
+	return Label(RootLabel + filepath.ToSlash(rel)), nil
+}
+
+// ResolveLabel parses the label and, if it is relative, resolves it against
+// the package in the directory dir.
+func (w *Workspace) ResolveLabel(s, dir string) (Label, error) {
+	l, err := ParseLabel(s)
+	if err != nil {
+		return "", err
+	}
+	if !l.IsRelative() {
+		return l, nil
+	}
+	pkg, err := w.DirLabel(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", s, err)
+	}
+	return l.Resolve(pkg), nil
+}
+
+// realPath returns the absolute path with symlinks resolved, so that paths
+// to the same directory can be compared.
+func realPath(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(p)
+}
+
+func (l Label) String() string {
+	return string(l)
+}
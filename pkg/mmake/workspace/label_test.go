@@ -0,0 +1,116 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLabel(t *testing.T) {
+	tests := []struct {
+		label   string
+		pkg     Label
+		target  string
+		path    string
+		wantErr bool
+	}{
+		{label: "//", pkg: "//"},
+		{label: "//:build", pkg: "//", target: "build"},
+		{label: "//services/api", pkg: "//services/api", path: "services/api"},
+		{label: "//services/api:build", pkg: "//services/api", target: "build", path: "services/api"},
+		{label: "//services/...:test", pkg: "//services/...", target: "test", path: "services/..."},
+		{label: ":build", pkg: "", target: "build"},
+		{label: "api:build", pkg: "api", target: "build", path: "api"},
+		{label: "api/builder:x", pkg: "api/builder", target: "x", path: "api/builder"},
+		{label: "", wantErr: true},
+		{label: "/", wantErr: true},
+		{label: "/services:build", wantErr: true},
+		{label: "api", wantErr: true},
+		{label: "//services/api:", wantErr: true},
+		{label: "//services/api:build:x", wantErr: true},
+		{label: "//services//api:build", wantErr: true},
+		{label: "//services/api/:build", wantErr: true},
+		{label: "//services/../api:build", wantErr: true},
+		{label: "//services/api:bu ild", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, err := ParseLabel(tt.label)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var invalid *ErrInvalidLabel
+				if !errors.As(err, &invalid) {
+					t.Errorf("ParseLabel() error = %T, want *ErrInvalidLabel", err)
+				}
+				return
+			}
+			if got.String() != tt.label {
+				t.Errorf("Label.String() = %s, want %s", got, tt.label)
+			}
+			if got.Package() != tt.pkg {
+				t.Errorf("Label.Package() = %s, want %s", got.Package(), tt.pkg)
+			}
+			if got.Target() != tt.target {
+				t.Errorf("Label.Target() = %s, want %s", got.Target(), tt.target)
+			}
+			if got.Path() != tt.path {
+				t.Errorf("Label.Path() = %s, want %s", got.Path(), tt.path)
+			}
+		})
+	}
+}
+
+func TestLabel_Resolve(t *testing.T) {
+	tests := []struct {
+		label string
+		pkg   Label
+		want  Label
+	}{
+		{label: ":build", pkg: "//services/api", want: "//services/api:build"},
+		{label: "builder:x", pkg: "//services/api", want: "//services/api/builder:x"},
+		{label: ":build", pkg: "//", want: "//:build"},
+		{label: "services/api:build", pkg: "//", want: "//services/api:build"},
+		{label: ":build", pkg: "//services/api:deploy", want: "//services/api:build"},
+		{label: "//other:build", pkg: "//services/api", want: "//other:build"},
+	}
+	for _, tt := range tests {
+		if got := Label(tt.label).Resolve(tt.pkg); got != tt.want {
+			t.Errorf("Label(%q).Resolve(%q) = %s, want %s", tt.label, tt.pkg, got, tt.want)
+		}
+	}
+}
+
+func TestWorkspace_ResolveLabel(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "services", "api"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	w := New(root)
+
+	tests := []struct {
+		label   string
+		dir     string
+		want    Label
+		wantErr bool
+	}{
+		{label: ":build", dir: filepath.Join(root, "services", "api"), want: "//services/api:build"},
+		{label: "builder:x", dir: filepath.Join(root, "services", "api"), want: "//services/api/builder:x"},
+		{label: ":build", dir: root, want: "//:build"},
+		{label: "//services:build", dir: outside, want: "//services:build"},
+		{label: ":build", dir: outside, wantErr: true},
+		{label: "build", dir: root, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := w.ResolveLabel(tt.label, tt.dir)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Workspace.ResolveLabel(%q, %q) error = %v, wantErr %v", tt.label, tt.dir, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Workspace.ResolveLabel(%q, %q) = %s, want %s", tt.label, tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package workspace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// prefixWriter writes every line to the underlying writer with a prefix.
+// Lines are written whole so that the output of targets running in parallel
+// doesn't interleave mid-line.
+type prefixWriter struct {
+	// mu guards w and is shared between all writers to w
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	return &prefixWriter{mu: mu, w: w, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any remaining partial line.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+// writeLine writes the prefix and the line with a single Write, so that
+// writers sharing a file descriptor without sharing mu don't split it either.
+func (p *prefixWriter) writeLine(line []byte) error {
+	b := make([]byte, 0, len(p.prefix)+len(line))
+	b = append(append(b, p.prefix...), line...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(b)
+	return err
+}
+
+// sameWriter returns true if a and b are the same writer.
+func sameWriter(a, b io.Writer) bool {
+	// comparing interfaces holding uncomparable values panics
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,119 @@
+package workspace
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+const (
+	// recursivePattern matches a package and all of the packages below it
+	recursivePattern = "..."
+	// childPattern matches the direct child packages of a package
+	childPattern = "*"
+	// allTargets matches every target in a package
+	allTargets = "all"
+)
+
+// IsPattern returns true if the label contains a wildcard, e.g.
+//
+//	//...:build          every package that defines build
+//	//services/*:test    direct children of //services that define test
+//	//services/api:all   every target in //services/api
+func IsPattern(label string) bool {
+	pkg, target, _ := strings.Cut(label, ":")
+	return pkg == RootLabel+recursivePattern ||
+		strings.HasSuffix(pkg, "/"+recursivePattern) ||
+		strings.HasSuffix(pkg, "/"+childPattern) ||
+		target == allTargets
+}
+
+// ExpandPattern returns the labels of the targets that match the pattern.
+// Only packages that define the target are matched. If a package defines a
+// target called `all` then `:all` refers to it, otherwise `:all` matches
+// every target in the package.
+func (q *Query) ExpandPattern(ctx context.Context, pattern string) ([]string, error) {
+	if !strings.HasPrefix(pattern, RootLabel) {
+		return nil, &ErrInvalidQuery{query: pattern, message: "pattern must start with //"}
+	}
+	pkg, target, ok := strings.Cut(pattern, ":")
+	if !ok || target == "" {
+		return nil, &ErrInvalidQuery{query: pattern, message: "pattern must specify a target, use :all to match every target"}
+	}
+
+	match := matchPackage(pkg)
+	var labels []string
+	for _, f := range q.files {
+		if !match(string(f.Label)) {
+			continue
+		}
+		if target != allTargets || f.HasTarget(allTargets) {
+			if f.HasTarget(target) {
+				labels = append(labels, TargetLabel(f.Label, target))
+			}
+			continue
+		}
+		for _, t := range f.Targets {
+			labels = append(labels, TargetLabel(f.Label, t))
+		}
+	}
+	return labels, nil
+}
+
+// ExpandPatterns expands every pattern in targets and leaves the rest as they are.
+// The workspace is scanned once, and only if there is a pattern to expand.
+// Duplicate labels are removed.
+func ExpandPatterns(ctx context.Context, ws *Workspace, targets []string) ([]string, error) {
+	var q *Query
+	var expanded []string
+	seen := map[string]bool{}
+	for _, t := range targets {
+		labels := []string{t}
+		if IsPattern(t) {
+			if q == nil {
+				q = NewQuery(ws, RootLabel)
+				if err := q.Update(ctx, 0); err != nil {
+					return nil, err
+				}
+			}
+			var err error
+			labels, err = q.ExpandPattern(ctx, t)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, l := range labels {
+			if !seen[l] {
+				seen[l] = true
+				expanded = append(expanded, l)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// matchPackage returns a function that matches package labels against the
+// package part of a pattern.
+func matchPackage(pkg string) func(label string) bool {
+	switch {
+	case pkg == RootLabel+recursivePattern:
+		return func(string) bool { return true }
+	case strings.HasSuffix(pkg, "/"+recursivePattern):
+		base := strings.TrimSuffix(pkg, "/"+recursivePattern)
+		return func(label string) bool {
+			return label == base || strings.HasPrefix(label, base+"/")
+		}
+	case strings.HasSuffix(pkg, "/"+childPattern):
+		base := strings.TrimSuffix(pkg, "/"+childPattern)
+		return func(label string) bool {
+			return label != RootLabel && path.Dir(label) == path.Clean(base)
+		}
+	default:
+		return func(label string) bool { return label == pkg }
+	}
+}
+
+// TargetLabel returns the label of the target in the package.
+func TargetLabel(pkg Label, target string) string {
+	return string(pkg) + ":" + target
+}
@@ -0,0 +1,68 @@
+package workspace
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestQuery_ExpandPattern(t *testing.T) {
+	files := []*BuildFile{
+		{Path: "/test/workspace/Makefile", Label: "//", Targets: []string{"build", "lint"}},
+		{Path: "/test/workspace/services/Makefile", Label: "//services", Targets: []string{"build"}},
+		{Path: "/test/workspace/services/api/Makefile", Label: "//services/api", Targets: []string{"build", "test", "deploy"}},
+		{Path: "/test/workspace/services/auth/Makefile", Label: "//services/auth", Targets: []string{"test"}},
+		{Path: "/test/workspace/services/auth/db/Makefile", Label: "//services/auth/db", Targets: []string{"test", "all"}},
+		{Path: "/test/workspace/servicesx/Makefile", Label: "//servicesx", Targets: []string{"test"}},
+	}
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "all packages",
+			pattern: "//...:build",
+			want:    []string{"//:build", "//services:build", "//services/api:build"},
+		},
+		{
+			name:    "recursive",
+			pattern: "//services/...:test",
+			want:    []string{"//services/api:test", "//services/auth:test", "//services/auth/db:test"},
+		},
+		{
+			name:    "direct children",
+			pattern: "//services/*:test",
+			want:    []string{"//services/api:test", "//services/auth:test"},
+		},
+		{
+			name:    "all targets",
+			pattern: "//services/api:all",
+			want:    []string{"//services/api:build", "//services/api:test", "//services/api:deploy"},
+		},
+		{
+			name:    "a target called all takes precedence",
+			pattern: "//services/auth/...:all",
+			want:    []string{"//services/auth:test", "//services/auth/db:all"},
+		},
+		{
+			name:    "target required",
+			pattern: "//services/...",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Query{ws: New("/test/workspace"), files: files}
+			got, err := q.ExpandPattern(context.Background(), tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Query.ExpandPattern() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query.ExpandPattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
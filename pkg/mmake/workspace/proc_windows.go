@@ -0,0 +1,11 @@
+//go:build windows
+
+package workspace
+
+import "os/exec"
+
+// setProcessGroup does nothing on windows, only the command itself is
+// killed when it is cancelled.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {}
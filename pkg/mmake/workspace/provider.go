@@ -0,0 +1,432 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Provider reads and runs a kind of build file other than a Makefile, so that
+// its targets are addressed with labels and completed like make targets.
+// Makefiles are built in and take precedence over every provider when a
+// package has more than one build file.
+type Provider interface {
+	// Name is the name of the tool that runs the build file, e.g. just
+	Name() string
+	// Match returns true if the file name is a build file of the provider
+	Match(name string) bool
+	// Parse reads the targets of the build file and their descriptions. The
+	// path and label of the returned build file are set by the workspace.
+	Parse(path string) (*BuildFile, error)
+	// Command returns the command that runs the target of the invocation,
+	// starting with the binary, and any variables to add to its environment.
+	// The command is run in the package directory.
+	Command(inv *Invocation) (args []string, env []string)
+}
+
+// providers are consulted in order, the first one matching a file wins.
+var providers = []Provider{
+	&JustProvider{},
+	&TaskProvider{},
+	&NPMProvider{},
+}
+
+// RegisterProvider adds a provider of build files. It takes precedence over
+// the providers registered before it, including the built in ones, but not
+// over Makefiles. It isn't safe to call while workspaces are in use.
+func RegisterProvider(p Provider) {
+	providers = append([]Provider{p}, providers...)
+}
+
+// providerFor returns the provider of the build file at path, or nil if it is
+// a Makefile or not a build file.
+func providerFor(path string) Provider {
+	name := filepath.Base(path)
+	if isMakefile(name) {
+		return nil
+	}
+	for _, p := range providers {
+		if p.Match(name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// buildFileRank returns how strongly a file name is preferred as the build file
+// of its package, lower is preferred, or -1 if it isn't a build file.
+func buildFileRank(name string) int {
+	if isMakefile(name) {
+		return 0
+	}
+	for i, p := range providers {
+		if p.Match(name) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// preferredBuildFile returns the name of the build file of a directory with
+// the given entries, or an empty string if there is none. Of equally
+// preferred files the first one wins.
+func preferredBuildFile(entries []os.DirEntry) string {
+	best, bestRank := "", -1
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if r := buildFileRank(e.Name()); r >= 0 && (bestRank < 0 || r < bestRank) {
+			best, bestRank = e.Name(), r
+		}
+	}
+	return best
+}
+
+// splitVars separates VAR=value arguments from flags.
+func splitVars(args []string) (vars, flags []string) {
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") {
+			flags = append(flags, a)
+		} else {
+			vars = append(vars, a)
+		}
+	}
+	return vars, flags
+}
+
+// JustProvider reads justfiles and runs their recipes with just. Recipes
+// whose names start with an underscore or that are marked [private] are left
+// out, as in `just --list`.
+type JustProvider struct {
+	// Binary is the just binary, defaults to just
+	Binary string
+}
+
+func (p *JustProvider) Name() string { return "just" }
+
+func (p *JustProvider) Match(name string) bool {
+	return name == "justfile" || name == "Justfile" || name == ".justfile"
+}
+
+// justRecipe matches the name at the start of a recipe line, e.g.
+// `@build target="x": deps`
+var justRecipe = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)\b`)
+
+// justKeywords start lines at the top level of a justfile that aren't recipes.
+var justKeywords = []string{"alias", "export", "set", "import", "mod"}
+
+// Parse reads the recipes of the justfile. The comment directly above a
+// recipe is its description and a comment on the first line of the file is
+// the description of the package, as in a Makefile.
+func (p *JustProvider) Parse(path string) (*BuildFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bf := &BuildFile{}
+	if first, _, _ := strings.Cut(string(b), "\n"); strings.HasPrefix(first, "#") && !strings.HasPrefix(first, "#!") {
+		bf.Description = strings.TrimSpace(strings.TrimPrefix(first, "#"))
+	}
+
+	var doc string
+	var private bool
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case line == "" || line[0] == ' ' || line[0] == '\t':
+			// a blank line or a recipe body
+			doc, private = "", false
+			continue
+		case strings.HasPrefix(line, "#"):
+			doc = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			continue
+		case strings.HasPrefix(line, "["):
+			// attributes are between the doc comment and the recipe
+			private = private || strings.Contains(line, "private")
+			continue
+		}
+		name, ok := justRecipeName(line)
+		if ok && !private && !strings.HasPrefix(name, "_") {
+			bf.Targets = append(bf.Targets, name)
+			if doc != "" {
+				if bf.TargetDescriptions == nil {
+					bf.TargetDescriptions = map[string]string{}
+				}
+				bf.TargetDescriptions[name] = doc
+			}
+		}
+		doc, private = "", false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// justRecipeName returns the name of the recipe declared on the line, or
+// false if the line isn't a recipe, e.g. an assignment.
+func justRecipeName(line string) (string, bool) {
+	m := justRecipe.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	for _, k := range justKeywords {
+		if m[1] == k && strings.HasPrefix(line, k+" ") {
+			return "", false
+		}
+	}
+	rest := line[len(m[0]):]
+	i := strings.Index(rest, ":")
+	if i < 0 || strings.HasPrefix(rest[i:], ":=") {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Command runs `just` with the justfile, the variables and flags and the
+// recipe, or the default recipe if there is no target.
+func (p *JustProvider) Command(inv *Invocation) ([]string, []string) {
+	bin := p.Binary
+	if bin == "" {
+		bin = "just"
+	}
+	vars, flags := splitVars(inv.Args)
+	args := []string{bin, "--justfile", inv.BuildFile, "--working-directory", inv.Dir}
+	args = append(args, flags...)
+	args = append(args, vars...)
+	if inv.Target != "" {
+		args = append(args, inv.Target)
+	}
+	return args, nil
+}
+
+// TaskProvider reads Taskfiles and runs their tasks with Task. Only the tasks
+// of the Taskfile itself are read, not included ones, and tasks marked
+// internal or with a ':' in their name, which can't be part of a label, are
+// left out.
+type TaskProvider struct {
+	// Binary is the Task binary, defaults to task
+	Binary string
+}
+
+func (p *TaskProvider) Name() string { return "task" }
+
+func (p *TaskProvider) Match(name string) bool {
+	switch name {
+	case "Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml":
+		return true
+	}
+	return false
+}
+
+// Parse reads the tasks and their desc from the tasks mapping of the
+// Taskfile. It understands the block style YAML that Taskfiles are written in
+// rather than all of YAML, so a desc has to be on the same line as its key.
+func (p *TaskProvider) Parse(path string) (*BuildFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bf := &BuildFile{}
+	var inTasks bool
+	var taskIndent, keyIndent int
+	var task string
+	internal := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 {
+			inTasks = trimmed == "tasks:"
+			taskIndent, task = 0, ""
+			continue
+		}
+		if !inTasks {
+			continue
+		}
+		if taskIndent == 0 {
+			taskIndent = indent
+		}
+		key, value, ok := yamlKeyValue(trimmed)
+		switch {
+		case indent == taskIndent:
+			task, keyIndent = "", 0
+			if ok && !strings.Contains(key, ":") {
+				task = key
+				bf.Targets = append(bf.Targets, task)
+			}
+		case task == "" || !ok:
+		case keyIndent == 0 || indent == keyIndent:
+			keyIndent = indent
+			switch key {
+			case "desc":
+				if value != "" && value != "|" && value != ">" {
+					if bf.TargetDescriptions == nil {
+						bf.TargetDescriptions = map[string]string{}
+					}
+					bf.TargetDescriptions[task] = value
+				}
+			case "internal":
+				internal[task] = value == "true"
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	targets := bf.Targets[:0]
+	for _, t := range bf.Targets {
+		if internal[t] {
+			delete(bf.TargetDescriptions, t)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	bf.Targets = targets
+	return bf, nil
+}
+
+// yamlKeyValue splits a `key: value` line of a YAML mapping, removing quotes
+// and trailing comments. ok is false if the line isn't a mapping entry.
+func yamlKeyValue(line string) (key, value string, ok bool) {
+	if strings.HasPrefix(line, "-") {
+		return "", "", false
+	}
+	if q := line[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(line[1:], q)
+		if end < 0 || !strings.HasPrefix(line[end+2:], ":") {
+			return "", "", false
+		}
+		key, value = line[1:end+1], line[end+3:]
+	} else {
+		i := strings.Index(line, ":")
+		if i < 0 || (i+1 < len(line) && line[i+1] != ' ') {
+			return "", "", false
+		}
+		key, value = line[:i], line[i+1:]
+	}
+	value = strings.TrimSpace(value)
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return key, value[1 : end+1], true
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return key, value, true
+}
+
+// Command runs `task` with the Taskfile, the flags, the task, or the default
+// task if there is no target, and the variables.
+func (p *TaskProvider) Command(inv *Invocation) ([]string, []string) {
+	bin := p.Binary
+	if bin == "" {
+		bin = "task"
+	}
+	vars, flags := splitVars(inv.Args)
+	args := []string{bin, "--taskfile", inv.BuildFile}
+	args = append(args, flags...)
+	if inv.Target != "" {
+		args = append(args, inv.Target)
+	}
+	return append(args, vars...), nil
+}
+
+// NPMProvider reads the scripts of package.json files and runs them with npm.
+type NPMProvider struct {
+	// Binary is the npm binary, defaults to npm
+	Binary string
+}
+
+func (p *NPMProvider) Name() string { return "npm" }
+
+func (p *NPMProvider) Match(name string) bool {
+	return name == "package.json"
+}
+
+// Parse reads the scripts in the order they are written. The description of
+// a script comes from the scripts-info object if it has one there, otherwise
+// it is the script itself. The description of the package is the package's
+// description.
+func (p *NPMProvider) Parse(path string) (*BuildFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Description string            `json:"description"`
+		Scripts     json.RawMessage   `json:"scripts"`
+		ScriptsInfo map[string]string `json:"scripts-info"`
+	}
+	if err := json.Unmarshal(b, &pkg); err != nil {
+		return nil, err
+	}
+	bf := &BuildFile{Description: pkg.Description}
+	if len(pkg.Scripts) == 0 {
+		return bf, nil
+	}
+
+	// a map would lose the order of the scripts
+	dec := json.NewDecoder(bytes.NewReader(pkg.Scripts))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("scripts must be an object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name := t.(string)
+		var script string
+		if err := dec.Decode(&script); err != nil {
+			return nil, fmt.Errorf("script %s: %w", name, err)
+		}
+		if strings.Contains(name, ":") {
+			// can't be part of a label
+			continue
+		}
+		bf.Targets = append(bf.Targets, name)
+		desc := pkg.ScriptsInfo[name]
+		if desc == "" {
+			desc = script
+		}
+		if desc != "" {
+			if bf.TargetDescriptions == nil {
+				bf.TargetDescriptions = map[string]string{}
+			}
+			bf.TargetDescriptions[name] = desc
+		}
+	}
+	return bf, nil
+}
+
+// Command runs `npm run` with the flags and the script. npm has no default
+// script, so it lists the scripts if there is no target. Variables are passed
+// to the script through its environment.
+func (p *NPMProvider) Command(inv *Invocation) ([]string, []string) {
+	bin := p.Binary
+	if bin == "" {
+		bin = "npm"
+	}
+	vars, flags := splitVars(inv.Args)
+	args := append([]string{bin, "run"}, flags...)
+	if inv.Target != "" {
+		args = append(args, inv.Target)
+	}
+	return args, vars
+}
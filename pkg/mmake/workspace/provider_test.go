@@ -0,0 +1,240 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProviders_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		file     string
+		content  string
+		want     *BuildFile
+	}{
+		{
+			name:     "justfile",
+			provider: &JustProvider{},
+			file:     "justfile",
+			content: `# Web app
+set shell := ["bash", "-c"]
+version := "1.0"
+alias b := build
+
+# Build the app
+build target="dist": _prepare
+	npm run build
+
+# Lint the app
+[private]
+hidden:
+	echo hidden
+
+_prepare:
+	mkdir -p dist
+
+@lint *args:
+	# not a description
+	eslint {{args}}
+`,
+			want: &BuildFile{
+				Description:        "Web app",
+				Targets:            []string{"build", "lint"},
+				TargetDescriptions: map[string]string{"build": "Build the app"},
+			},
+		},
+		{
+			name:     "Taskfile",
+			provider: &TaskProvider{},
+			file:     "Taskfile.yml",
+			content: `version: '3'
+
+vars:
+  GREETING: hello
+
+tasks:
+  build:
+    desc: Build the API
+    cmds:
+      - go build ./...
+  lint: golangci-lint run
+  "test":
+    desc: "Run the tests" # quoted
+    vars:
+      desc: not a description
+  db:migrate:
+    desc: Namespaced
+  setup:
+    internal: true
+    desc: Internal
+`,
+			want: &BuildFile{
+				Targets: []string{"build", "lint", "test"},
+				TargetDescriptions: map[string]string{
+					"build": "Build the API",
+					"test":  "Run the tests",
+				},
+			},
+		},
+		{
+			name:     "package.json",
+			provider: &NPMProvider{},
+			file:     "package.json",
+			content: `{
+  "name": "app",
+  "description": "The web app",
+  "scripts": {
+    "lint": "eslint .",
+    "build": "vite build",
+    "test:unit": "vitest"
+  },
+  "scripts-info": {
+    "build": "Build for production"
+  }
+}`,
+			want: &BuildFile{
+				Description: "The web app",
+				Targets:     []string{"lint", "build"},
+				TargetDescriptions: map[string]string{
+					"lint":  "eslint .",
+					"build": "Build for production",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(p, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.provider.Match(tt.file) {
+				t.Errorf("%T.Match(%s) = false, want true", tt.provider, tt.file)
+			}
+			got, err := tt.provider.Parse(p)
+			if err != nil {
+				t.Fatalf("%T.Parse() error = %v", tt.provider, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%T.Parse() = %+v, want %+v", tt.provider, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviders_Command(t *testing.T) {
+	inv := &Invocation{
+		Dir:       "/ws/web",
+		BuildFile: "/ws/web/file",
+		Target:    "build",
+		Args:      []string{"MODE=prod", "--verbose"},
+	}
+	tests := []struct {
+		provider Provider
+		wantArgs []string
+		wantEnv  []string
+	}{
+		{
+			provider: &JustProvider{},
+			wantArgs: []string{"just", "--justfile", "/ws/web/file", "--working-directory", "/ws/web", "--verbose", "MODE=prod", "build"},
+		},
+		{
+			provider: &TaskProvider{Binary: "go-task"},
+			wantArgs: []string{"go-task", "--taskfile", "/ws/web/file", "--verbose", "build", "MODE=prod"},
+		},
+		{
+			provider: &NPMProvider{},
+			wantArgs: []string{"npm", "run", "--verbose", "build"},
+			wantEnv:  []string{"MODE=prod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider.Name(), func(t *testing.T) {
+			args, env := tt.provider.Command(inv)
+			if !reflect.DeepEqual(args, tt.wantArgs) || !reflect.DeepEqual(env, tt.wantEnv) {
+				t.Errorf("%T.Command() = %v %v, want %v %v", tt.provider, args, env, tt.wantArgs, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestQuery_Update_providers(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"services/api/Makefile":               "build:\n",
+		"services/api/package.json":           `{"scripts": {"lint": "eslint ."}}`,
+		"web/app/package.json":                `{"scripts": {"lint": "eslint ."}}`,
+		"web/app/node_modules/x/package.json": `{"scripts": {"postinstall": "x"}}`,
+		"tools/justfile":                      "fmt:\n\tgofmt -w .\n",
+	})
+	q := NewQuery(w, RootLabel)
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	got := map[Label]string{}
+	for _, f := range q.Files() {
+		got[f.Label] = f.Tool
+	}
+	want := map[Label]string{
+		"//services/api": "make",
+		"//tools":        "just",
+		"//web/app":      "npm",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query.Update() tools = %v, want %v", got, want)
+	}
+}
+
+func TestWorkspace_RunTargets_provider(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"web/app/package.json": `{"scripts": {"lint": "eslint ."}}`,
+	})
+	var invocations []*Invocation
+	w.SetExecutor(ExecutorFunc(func(ctx context.Context, inv *Invocation) error {
+		invocations = append(invocations, inv)
+		return nil
+	}))
+
+	var out bytes.Buffer
+	if _, err := w.RunTargets(context.Background(), RunOptions{Stdout: &out}, "//web/app:lint"); err != nil {
+		t.Fatalf("Workspace.RunTargets() error = %v", err)
+	}
+	if len(invocations) != 1 {
+		t.Fatalf("ran %d targets, want 1", len(invocations))
+	}
+	inv := invocations[0]
+	if _, ok := inv.Provider.(*NPMProvider); !ok {
+		t.Errorf("Invocation.Provider = %T, want *NPMProvider", inv.Provider)
+	}
+	if want := filepath.Join(w.rootPath, "web", "app", "package.json"); inv.BuildFile != want || inv.Makefile != want {
+		t.Errorf("Invocation build file = %s and %s, want %s", inv.BuildFile, inv.Makefile, want)
+	}
+	if inv.Target != "lint" || inv.Dir != filepath.Dir(inv.BuildFile) {
+		t.Errorf("Invocation target and dir = %s %s, want lint in the package", inv.Target, inv.Dir)
+	}
+}
+
+func TestQuery_Update_invalidProviderFile(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":     "build:\n",
+		"web/package.json": `{"scripts": {`,
+	})
+	q := NewQuery(w, RootLabel)
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	var got []Label
+	for _, f := range q.Files() {
+		got = append(got, f.Label)
+	}
+	if want := []Label{"//api"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Query.Update() packages = %v, want %v", got, want)
+	}
+	if len(q.Skipped()) != 1 {
+		t.Errorf("Query.Skipped() = %v, want the error of web/package.json", q.Skipped())
+	}
+}
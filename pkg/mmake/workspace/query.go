@@ -3,7 +3,6 @@ package workspace
 import (
 	"context"
 	"fmt"
-	"os"
 	"path"
 	"path/filepath"
 	"sort"
@@ -28,15 +27,16 @@ func (q *Query) QueryFilesByPrefix(ctx context.Context, prefix string) ([]*Build
 		return nil, &ErrInvalidQuery{query: prefix, message: "prefix must be at least 2 characters"}
 	}
 	// strip //
-	if prefix[:2] == RootLabel {
-		prefix = prefix[2:]
-	}
+	prefix = strings.TrimPrefix(prefix, RootLabel)
 	// get directory of the prefix and compare to the directory of the file
 	// if they match, then add the file to the list
 	prefixPath := path.Join(q.ws.rootPath, prefix)
 
 	// if the prefix is the root directory, then return the root Makefile
 	if prefixPath == q.ws.rootPath {
+		if len(q.files) == 0 {
+			return []*BuildFile{}, nil
+		}
 		return []*BuildFile{q.files[0]}, nil
 	}
 
@@ -115,6 +115,11 @@ func (q *Query) GenComp(ctx context.Context, prefix string) (string, error) {
 	return outputStr, nil
 }
 
+// Files returns the build files found by the last Update.
+func (q *Query) Files() []*BuildFile {
+	return q.files
+}
+
 func (q *Query) GetFileByLabel(label Label) *BuildFile {
 	for _, v := range q.files {
 		if v.Label == label {
@@ -192,9 +197,7 @@ func (q *Query) genCompFiles(ctx context.Context, prefix string) ([]string, erro
 	}
 
 	// strip //
-	if prefix[:2] == RootLabel {
-		prefix = prefix[2:]
-	}
+	prefix = strings.TrimPrefix(prefix, RootLabel)
 	// get directory of the prefix and compare to the directory of the file
 	// if they match, then add the file to the list
 	prefixPath := path.Join(q.ws.rootPath, prefix)
@@ -309,17 +312,17 @@ func (q *Query) genCompFiles(ctx context.Context, prefix string) ([]string, erro
 
 func GetPackageFromFile(filePath string, rootPath string) (string, error) {
 	// get the directory of the file
-	dir := filepath.Dir(filePath)
-	if dir == rootPath {
+	rel, err := filepath.Rel(rootPath, filepath.Dir(filePath))
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
 		return RootLabel, nil
 	}
-	dir = dir[len(rootPath):]
-
-	// strip the leading '/'
-	dir = dir[1:]
-
-	// prepend '//'
-	return RootLabel + dir, nil
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is outside of the workspace %s", filePath, rootPath)
+	}
+	return RootLabel + filepath.ToSlash(rel), nil
 }
 
 // QueryTargetsByFile returns a list of targets that are contained within the given file
@@ -335,6 +338,9 @@ type Query struct {
 	// the list of workspace-aware files in the workspace
 	files []*BuildFile
 	tree  *Node
+	// skipped are the errors of the build files that couldn't be parsed by
+	// their provider
+	skipped []error
 }
 
 func NewQuery(ws *Workspace, updatePrefix string) *Query {
@@ -342,58 +348,93 @@ func NewQuery(ws *Workspace, updatePrefix string) *Query {
 }
 
 // Update updates the workspace by re-scanning the workspace directory
-// and re-parsing all of the Makefiles.
+// and re-parsing all of the Makefiles. If the workspace is configured with
+// DiscoverMake then the targets are read from make's database instead.
+// Directories and Makefiles that haven't changed since the last scan are
+// read from the index in the build directory. Paths ignored by the
+// configuration, .gitignore or .mmakeignore files are skipped, and so are
+// package.json, justfile and Taskfile build files that can't be parsed, see
+// Skipped.
 // Depth is the depth of the directory tree to scan relative to the first BuildFile found in a subtree. If depth is 0, then
 // the entire tree is scanned.
 func (q *Query) Update(ctx context.Context, depth int) error {
 	// clear the list of files
 	q.files = nil
+	q.skipped = nil
 	relativeTo := path.Join(q.ws.rootPath, path.Dir(q.updatePrefix))
 	q.tree = &Node{dirPath: relativeTo}
 	// TODO: search for the nearest package above (maybe below?) and start from there
-	// walk the workspace directory and find all the Makefiles
-	return filepath.WalkDir(relativeTo, func(pp string, d os.DirEntry, err error) error {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if err != nil {
-				return err
-			}
-
-			if d.IsDir() {
-				for _, v := range q.ws.ignoreDirs {
-					if d.Name() == v {
-						return filepath.SkipDir
-					}
-				}
-				// if we have a directory then check if we already have
-				// a BuildFile underneath it or as a sibling, if so then skip
-				if depth > 0 {
-					if q.shouldSkipDir(pp, depth) {
-						return filepath.SkipDir
-					}
-				}
-				return nil
-			}
+	rules, err := q.ws.ignoreRulesAbove(relativeTo)
+	if err != nil {
+		return err
+	}
+	idx := q.ws.loadIndex()
+	if err := q.scanDir(ctx, idx, relativeTo, depth, rules); err != nil {
+		return err
+	}
+	q.ws.saveIndex(idx)
+	return nil
+}
 
-			if !d.IsDir() && FileIsBuildFile(d.Name()) {
-				// parse
-				f, err := ParseBuildFile(pp, q.ws.rootPath)
-				if err != nil {
-					return fmt.Errorf("failed to parse build file %s: %w", pp, err)
-				}
-				// add the file to the tree
-				newNode := &Node{dirPath: path.Dir(pp)}
+// scanDir finds the build files in dir and below it, in lexical order. rules
+// are the ignore rules from the directories above dir.
+func (q *Query) scanDir(ctx context.Context, idx *index, dir string, depth int, rules ignoreRules) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if q.ws.isIgnored(rules, dir, true) {
+		return nil
+	}
+	// if we have a directory then check if we already have
+	// a BuildFile underneath it or as a sibling, if so then skip
+	if depth > 0 && q.shouldSkipDir(dir, depth) {
+		return nil
+	}
 
-				parent := q.tree.GetDeepestParent(newNode)
-				parent.Children = append(parent.Children, &Node{dirPath: path.Dir(pp)})
-				q.files = append(q.files, f)
+	entries, err := idx.entries(q.ws, dir)
+	if err != nil {
+		return err
+	}
+	// ignore files aren't indexed since changing one doesn't change the
+	// modification time of its directory
+	rules, err = q.ws.withIgnoreFiles(rules, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		pp := path.Join(dir, e.Name)
+		if e.Dir {
+			if err := q.scanDir(ctx, idx, pp, depth, rules); err != nil {
+				return err
 			}
+			continue
+		}
+		if q.ws.isIgnored(rules, pp, false) {
+			continue
+		}
 
-			return nil
+		f, err := idx.buildFile(ctx, q.ws, pp)
+		if err != nil && providerFor(pp) != nil {
+			// a broken package.json shouldn't hide the rest of the workspace
+			q.skipped = append(q.skipped, err)
+			continue
+		} else if err != nil {
+			return err
 		}
-	})
+		// add the file to the tree
+		newNode := &Node{dirPath: path.Dir(pp)}
+
+		parent := q.tree.GetDeepestParent(newNode)
+		parent.Children = append(parent.Children, &Node{dirPath: path.Dir(pp)})
+		q.files = append(q.files, f)
+	}
+	return nil
+}
+
+// Skipped returns the errors of the build files that the last Update skipped
+// because their provider couldn't parse them.
+func (q *Query) Skipped() []error {
+	return q.skipped
 }
 
 type Node struct {
@@ -0,0 +1,251 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aakarim/mmake/internal/makefile"
+)
+
+// TargetInfo describes a single target in the workspace.
+type TargetInfo struct {
+	// Label is the full label of the target, e.g. //services/api:build
+	Label string `json:"label"`
+	// Package is the label of the package that defines the target
+	Package Label `json:"package"`
+	// Name is the name of the target in the build file
+	Name string `json:"target"`
+	// Path is the path to the build file
+	Path string `json:"path"`
+	// Description is the comment at the start of the recipe (if any)
+	Description string `json:"description,omitempty"`
+	// Prerequisites are the labels of the direct prerequisites of the target
+	Prerequisites []string `json:"prerequisites,omitempty"`
+}
+
+// Targets returns every target in the files found by the last Update.
+func (q *Query) Targets(ctx context.Context) ([]*TargetInfo, error) {
+	var targets []*TargetInfo
+	for _, f := range q.files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var mf *makefile.File
+		if f.discovered == nil {
+			b, err := os.ReadFile(f.Path)
+			if err != nil {
+				return nil, fmt.Errorf("read build file: %w", err)
+			}
+			// parse once rather than once per target, a file that doesn't
+			// parse just has no descriptions or prerequisites
+			mf, _ = makefile.Parse(bytes.NewReader(b))
+		}
+		for _, name := range f.Targets {
+			info := &TargetInfo{
+				Label:   TargetLabel(f.Label, name),
+				Package: f.Label,
+				Name:    name,
+				Path:    f.Path,
+			}
+			t := f.target(name)
+			if mf != nil {
+				t = mf.Target(name)
+			}
+			if t != nil {
+				info.Description = describeTarget(t)
+				for _, p := range t.Prerequisites {
+					if !isLabelPrerequisite(p) {
+						p = TargetLabel(f.Label, p)
+					}
+					info.Prerequisites = append(info.Prerequisites, p)
+				}
+			}
+			targets = append(targets, info)
+		}
+	}
+	return targets, nil
+}
+
+// describeTarget returns the comment lines at the start of the recipe
+// without the leading '#'.
+func describeTarget(t *makefile.Target) string {
+	var lines []string
+	for _, l := range strings.Split(t.Body, "\n") {
+		l = strings.TrimSpace(l)
+		if !strings.HasPrefix(l, "#") {
+			break
+		}
+		if isAnnotation(l) {
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(l, "#")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// QueryExpr is a parsed query expression. An expression is a list of
+// filters separated by whitespace, and a target must match all of them.
+// A filter can be negated by prefixing it with '!'.
+//
+//	pkg(//services)          targets in //services or below
+//	target(^deploy$)         targets whose name matches the regular expression
+//	desc(api)                targets whose description contains the text
+//	deps(//services/auth:build) targets that depend on the label, directly or not
+//
+// e.g. `pkg(//services) target(^deploy$) !desc(deprecated)`.
+type QueryExpr struct {
+	filters []queryFilter
+}
+
+type queryFilter struct {
+	negate bool
+	match  func(t *TargetInfo, deps *dependencyIndex) bool
+}
+
+// ParseQueryExpr parses a query expression.
+func ParseQueryExpr(expr string) (*QueryExpr, error) {
+	qe := &QueryExpr{}
+	rest := strings.TrimSpace(expr)
+	for rest != "" {
+		var negate bool
+		if rest[0] == '!' {
+			negate = true
+			rest = rest[1:]
+		}
+
+		open := strings.IndexByte(rest, '(')
+		if open < 0 {
+			return nil, &ErrInvalidQuery{query: expr, message: fmt.Sprintf("expected a filter like name(arg) at %q", rest)}
+		}
+		name := rest[:open]
+
+		// find the matching ')' so that arguments may contain parentheses
+		closing := -1
+		depth := 0
+		for i := open; i < len(rest) && closing < 0; i++ {
+			switch rest[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					closing = i
+				}
+			}
+		}
+		if closing < 0 {
+			return nil, &ErrInvalidQuery{query: expr, message: fmt.Sprintf("missing ')' in %q", rest)}
+		}
+		arg := strings.TrimSpace(rest[open+1 : closing])
+		rest = strings.TrimSpace(rest[closing+1:])
+
+		match, err := newQueryFilter(name, arg)
+		if err != nil {
+			return nil, &ErrInvalidQuery{query: expr, message: err.Error()}
+		}
+		qe.filters = append(qe.filters, queryFilter{negate: negate, match: match})
+	}
+	return qe, nil
+}
+
+func newQueryFilter(name, arg string) (func(t *TargetInfo, deps *dependencyIndex) bool, error) {
+	switch name {
+	case "pkg":
+		if !strings.HasPrefix(arg, RootLabel) {
+			return nil, fmt.Errorf("pkg() requires a label starting with //")
+		}
+		match := matchPackage(strings.TrimSuffix(arg, "/") + "/" + recursivePattern)
+		if arg == RootLabel {
+			match = matchPackage(RootLabel + recursivePattern)
+		}
+		return func(t *TargetInfo, _ *dependencyIndex) bool {
+			return match(string(t.Package))
+		}, nil
+	case "target":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("target(): %w", err)
+		}
+		return func(t *TargetInfo, _ *dependencyIndex) bool {
+			return re.MatchString(t.Name)
+		}, nil
+	case "desc":
+		text := strings.ToLower(arg)
+		return func(t *TargetInfo, _ *dependencyIndex) bool {
+			return strings.Contains(strings.ToLower(t.Description), text)
+		}, nil
+	case "deps":
+		if !strings.HasPrefix(arg, RootLabel) || !strings.Contains(arg, ":") {
+			return nil, fmt.Errorf("deps() requires a target label like //pkg:target")
+		}
+		return func(t *TargetInfo, deps *dependencyIndex) bool {
+			return deps.dependsOn(t.Label, arg)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown filter %q", name)
+	}
+}
+
+// Filter returns the targets that match the expression.
+func (qe *QueryExpr) Filter(targets []*TargetInfo) []*TargetInfo {
+	deps := newDependencyIndex(targets)
+	var out []*TargetInfo
+	for _, t := range targets {
+		matched := true
+		for _, f := range qe.filters {
+			if f.match(t, deps) == f.negate {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// dependencyIndex answers whether a target depends on another, following
+// prerequisites transitively.
+type dependencyIndex struct {
+	prereqs map[string][]string
+	// closure caches the transitive dependencies of each target
+	closure map[string]map[string]bool
+}
+
+func newDependencyIndex(targets []*TargetInfo) *dependencyIndex {
+	d := &dependencyIndex{prereqs: map[string][]string{}, closure: map[string]map[string]bool{}}
+	for _, t := range targets {
+		d.prereqs[t.Label] = t.Prerequisites
+	}
+	return d
+}
+
+func (d *dependencyIndex) dependsOn(label, dep string) bool {
+	return d.transitive(label)[dep]
+}
+
+func (d *dependencyIndex) transitive(label string) map[string]bool {
+	if c, ok := d.closure[label]; ok {
+		return c
+	}
+	// the closure is only cached once it is complete, reusing the closures of
+	// the prerequisites would leave some of them partial in a cycle
+	c := map[string]bool{}
+	stack := append([]string{}, d.prereqs[label]...)
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c[p] {
+			continue
+		}
+		c[p] = true
+		stack = append(stack, d.prereqs[p]...)
+	}
+	d.closure[label] = c
+	return c
+}
@@ -0,0 +1,106 @@
+package workspace
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryExpr_Filter(t *testing.T) {
+	targets := []*TargetInfo{
+		{Label: "//:lint", Package: "//", Name: "lint"},
+		{Label: "//services/api:build", Package: "//services/api", Name: "build", Prerequisites: []string{"//lib:build"}},
+		{Label: "//services/api:deploy", Package: "//services/api", Name: "deploy", Description: "Deploy the API service", Prerequisites: []string{"//services/api:build"}},
+		{Label: "//services/auth:deploy", Package: "//services/auth", Name: "deploy", Description: "Deploy auth (deprecated)"},
+		{Label: "//lib:build", Package: "//lib", Name: "build"},
+	}
+	tests := []struct {
+		name    string
+		expr    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "empty matches everything",
+			expr: "",
+			want: []string{"//:lint", "//services/api:build", "//services/api:deploy", "//services/auth:deploy", "//lib:build"},
+		},
+		{
+			name: "package prefix",
+			expr: "pkg(//services/)",
+			want: []string{"//services/api:build", "//services/api:deploy", "//services/auth:deploy"},
+		},
+		{
+			name: "target regex",
+			expr: "target(^dep)",
+			want: []string{"//services/api:deploy", "//services/auth:deploy"},
+		},
+		{
+			name: "description is case insensitive and can be negated",
+			expr: "target(deploy) !desc(DEPRECATED)",
+			want: []string{"//services/api:deploy"},
+		},
+		{
+			name: "transitive dependencies",
+			expr: "deps(//lib:build)",
+			want: []string{"//services/api:build", "//services/api:deploy"},
+		},
+		{
+			name: "parentheses in arguments",
+			expr: "target((build|lint))",
+			want: []string{"//:lint", "//services/api:build", "//lib:build"},
+		},
+		{
+			name:    "unknown filter",
+			expr:    "foo(bar)",
+			wantErr: true,
+		},
+		{
+			name:    "unbalanced parentheses",
+			expr:    "target(build",
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			expr:    "target([)",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qe, err := ParseQueryExpr(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseQueryExpr() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []string
+			for _, t := range qe.Filter(targets) {
+				got = append(got, t.Label)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryExpr.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryExpr_Filter_cycle(t *testing.T) {
+	targets := []*TargetInfo{
+		{Label: "//x:a", Package: "//x", Name: "a", Prerequisites: []string{"//x:b", "//x:d"}},
+		{Label: "//x:b", Package: "//x", Name: "b", Prerequisites: []string{"//x:a"}},
+		{Label: "//x:d", Package: "//x", Name: "d"},
+	}
+	qe, err := ParseQueryExpr("deps(//x:d)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, t := range qe.Filter(targets) {
+		got = append(got, t.Label)
+	}
+	if want := []string{"//x:a", "//x:b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryExpr.Filter() = %v, want %v", got, want)
+	}
+}
@@ -337,3 +337,20 @@ func TestQuery_shouldSkipDir(t *testing.T) {
 		})
 	}
 }
+
+func TestQuery_QueryFilesByPrefix_emptyWorkspace(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{"README.md": "no build files\n"})
+	q := NewQuery(w, RootLabel)
+	if err := q.Update(context.Background(), 0); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	for _, prefix := range []string{RootLabel, "//services"} {
+		files, err := q.QueryFilesByPrefix(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("Query.QueryFilesByPrefix(%s) error = %v", prefix, err)
+		}
+		if len(files) != 0 {
+			t.Errorf("Query.QueryFilesByPrefix(%s) = %v, want none", prefix, files)
+		}
+	}
+}
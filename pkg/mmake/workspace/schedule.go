@@ -0,0 +1,225 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTargetsFailed is returned when one or more of the targets in a
+// multi-target run fail.
+type ErrTargetsFailed struct {
+	Failed []string
+	// Err is the error of the first target that failed
+	Err error
+}
+
+func (e *ErrTargetsFailed) Error() string {
+	return fmt.Sprintf("targets failed: %s", strings.Join(e.Failed, ", "))
+}
+
+func (e *ErrTargetsFailed) Unwrap() error {
+	return e.Err
+}
+
+// RunOptions configures how targets are run.
+type RunOptions struct {
+	// Jobs is the number of targets that can run in parallel, defaults to 1
+	Jobs int
+	// Stdout, Stderr and Stdin default to the process' own streams
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+	// MakeArgs are passed to make for the requested targets but not for
+	// their dependencies, e.g. VAR=value overrides and flags like -k or -B
+	MakeArgs []string
+	// ProcessGroup runs make in a process group of its own, so that
+	// cancelling a run also stops the processes started by the recipes,
+	// such as dev servers. Recipes can't read from the terminal then.
+	ProcessGroup bool
+}
+
+// Target statuses reported in a TargetResult.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// StatusCached is reported for targets whose outputs were restored from
+	// the cache instead of running them
+	StatusCached = "cached"
+	// StatusSkipped is reported for targets that weren't started because
+	// an earlier target failed
+	StatusSkipped = "skipped"
+)
+
+// TargetResult is the outcome of running a single target.
+type TargetResult struct {
+	Label  string `json:"label"`
+	Status string `json:"status"`
+	// ExitCode is the exit code of make, or -1 if it couldn't be run
+	ExitCode   int   `json:"exit_code"`
+	DurationMS int64 `json:"duration_ms"`
+	Err        error `json:"-"`
+
+	// cacheKey is the cache key of the target, or empty if it ran without
+	// the cache
+	cacheKey string
+}
+
+// RunTargets runs the targets and their cross-package dependencies, running
+// up to opts.Jobs independent targets in parallel. A target is only started
+// once all of its dependencies have succeeded. After the first failure no new
+// targets are started, but the ones already running are left to finish.
+//
+// When more than one target is requested or jobs is more than one the output
+// of each target is prefixed with its label.
+//
+// A result is returned for every target in dependency order, even if running
+// them failed.
+func (w *Workspace) RunTargets(ctx context.Context, opts RunOptions, targets ...string) ([]*TargetResult, error) {
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	stdout, stderr, stdin := opts.Stdout, opts.Stderr, opts.Stdin
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+
+	g, err := w.resolveGraph(ctx, targets...)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixOutput := jobs > 1 || len(targets) > 1
+	var stdoutMu, stderrMu sync.Mutex
+	errMu := &stderrMu
+	if sameWriter(stdout, stderr) {
+		// e.g. stdout is sent to stderr for JSON output
+		errMu = &stdoutMu
+	}
+
+	// count the unfinished dependencies of every target and queue the ones without any
+	results := map[string]*TargetResult{}
+	remaining := map[string]int{}
+	dependents := map[string][]string{}
+	var ready []string
+	for _, t := range g.order {
+		results[t] = &TargetResult{Label: t, Status: StatusSkipped, ExitCode: -1}
+		remaining[t] = len(g.deps[t])
+		for _, d := range g.deps[t] {
+			dependents[d] = append(dependents[d], t)
+		}
+		if remaining[t] == 0 {
+			ready = append(ready, t)
+		}
+	}
+
+	done := make(chan *TargetResult)
+	run := func(target string, depKeys []string) {
+		start := time.Now()
+		targetOpts := opts
+		targetOpts.MakeArgs = g.makeArgs(target, opts.MakeArgs)
+		var cacheKey string
+		var cached bool
+		var err error
+		if !prefixOutput {
+			cacheKey, cached, err = w.runTarget(ctx, target, targetOpts, depKeys, stdout, stderr, stdin)
+		} else {
+			out := newPrefixWriter(stdout, &stdoutMu, "["+target+"] ")
+			errOut := newPrefixWriter(stderr, errMu, "["+target+"] ")
+			// only a single target at a time can read from stdin
+			var in io.Reader
+			if jobs == 1 {
+				in = stdin
+			}
+			cacheKey, cached, err = w.runTarget(ctx, target, targetOpts, depKeys, out, errOut, in)
+			out.Flush()
+			errOut.Flush()
+		}
+		r := newTargetResult(target, start, cached, err)
+		r.cacheKey = cacheKey
+		done <- r
+	}
+
+	var failed []string
+	var firstErr error
+	var running int
+	for {
+		for firstErr == nil && ctx.Err() == nil && running < jobs && len(ready) > 0 {
+			running++
+			// the dependencies have finished, so their results are final
+			var depKeys []string
+			for _, d := range g.deps[ready[0]] {
+				depKeys = append(depKeys, results[d].cacheKey)
+			}
+			go run(ready[0], depKeys)
+			ready = ready[1:]
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-done
+		running--
+		results[r.Label] = r
+		if r.Err != nil {
+			failed = append(failed, r.Label)
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+			continue
+		}
+		for _, d := range dependents[r.Label] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	ordered := make([]*TargetResult, 0, len(g.order))
+	for _, t := range g.order {
+		ordered = append(ordered, results[t])
+	}
+
+	if firstErr != nil {
+		if len(g.order) == 1 {
+			return ordered, firstErr
+		}
+		return ordered, &ErrTargetsFailed{Failed: failed, Err: firstErr}
+	}
+	return ordered, ctx.Err()
+}
+
+func newTargetResult(target string, start time.Time, cached bool, err error) *TargetResult {
+	r := &TargetResult{
+		Label:      target,
+		Status:     StatusSucceeded,
+		DurationMS: time.Since(start).Milliseconds(),
+		Err:        err,
+	}
+	if cached {
+		r.Status = StatusCached
+	}
+	if err != nil {
+		r.Status = StatusFailed
+		r.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			r.ExitCode = exitErr.ExitCode()
+		}
+	}
+	return r
+}
@@ -0,0 +1,169 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var b bytes.Buffer
+	var mu sync.Mutex
+	w := newPrefixWriter(&b, &mu, "[//api:build] ")
+	w.Write([]byte("hello\nwor"))
+	w.Write([]byte("ld\npartial"))
+	w.Flush()
+
+	want := "[//api:build] hello\n[//api:build] world\n[//api:build] partial\n"
+	if b.String() != want {
+		t.Errorf("prefixWriter wrote %q, want %q", b.String(), want)
+	}
+}
+
+// writesRecorder records every call to Write.
+type writesRecorder struct {
+	writes []string
+}
+
+func (r *writesRecorder) Write(b []byte) (int, error) {
+	r.writes = append(r.writes, string(b))
+	return len(b), nil
+}
+
+func TestPrefixWriter_singleWrite(t *testing.T) {
+	var r writesRecorder
+	var mu sync.Mutex
+	w := newPrefixWriter(&r, &mu, "[//api:build] ")
+	w.Write([]byte("hello\nworld\n"))
+
+	want := []string{"[//api:build] hello\n", "[//api:build] world\n"}
+	if !reflect.DeepEqual(r.writes, want) {
+		t.Errorf("prefixWriter wrote %q, want a write per line %q", r.writes, want)
+	}
+}
+
+func TestSameWriter(t *testing.T) {
+	var a, b bytes.Buffer
+	tests := []struct {
+		name string
+		a, b io.Writer
+		want bool
+	}{
+		{name: "same", a: &a, b: &a, want: true},
+		{name: "different", a: &a, b: &b},
+		{name: "same file", a: os.Stderr, b: os.Stderr, want: true},
+		{name: "different types", a: &a, b: os.Stderr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameWriter(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameWriter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspace_RunTargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		targets    []string
+		wantRan    []string
+		wantFailed []string
+	}{
+		{
+			name: "independent targets all run",
+			files: map[string]string{
+				"api/Makefile":  "build:\n\t@touch $(MM_OUT_PATH)/ran\n",
+				"auth/Makefile": "build:\n\t@touch $(MM_OUT_PATH)/ran\n",
+			},
+			targets: []string{"//api:build", "//auth:build"},
+			wantRan: []string{"api", "auth"},
+		},
+		{
+			name: "dependents of a failed target are not run",
+			files: map[string]string{
+				"api/Makefile":  "build: //auth:build\n\t@touch $(MM_OUT_PATH)/ran\n",
+				"auth/Makefile": "build:\n\t@exit 1\n",
+				"lib/Makefile":  "build:\n\t@touch $(MM_OUT_PATH)/ran\n",
+			},
+			targets:    []string{"//lib:build", "//api:build"},
+			wantRan:    []string{"lib"},
+			wantFailed: []string{"//auth:build"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := writeWorkspace(t, tt.files)
+			_, err := w.RunTargets(context.Background(), RunOptions{Jobs: 4}, tt.targets...)
+
+			var failedErr *ErrTargetsFailed
+			if errors.As(err, &failedErr) {
+				if !reflect.DeepEqual(failedErr.Failed, tt.wantFailed) {
+					t.Errorf("Workspace.RunTargets() failed = %v, want %v", failedErr.Failed, tt.wantFailed)
+				}
+			} else if err != nil || tt.wantFailed != nil {
+				t.Fatalf("Workspace.RunTargets() error = %v, want failed %v", err, tt.wantFailed)
+			}
+
+			for pkg := range tt.files {
+				pkg = filepath.Dir(pkg)
+				_, err := os.Stat(filepath.Join(w.buildRoot(), pkg, "ran"))
+				ran := err == nil
+				var wantRan bool
+				for _, p := range tt.wantRan {
+					wantRan = wantRan || p == pkg
+				}
+				if ran != wantRan {
+					t.Errorf("package %s ran = %v, want %v", pkg, ran, wantRan)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkspace_RunTargets_makeArgs(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile": "lint: //lib:build\n\t@echo lint $(ARGS)\n",
+		"lib/Makefile": "build:\n\t@echo build $(ARGS)\n",
+	})
+	var out bytes.Buffer
+	opts := RunOptions{Stdout: &out, MakeArgs: []string{"ARGS=--fix -- x"}}
+	if _, err := w.RunTargets(context.Background(), opts, "//api:lint"); err != nil {
+		t.Fatalf("Workspace.RunTargets() error = %v", err)
+	}
+	// the arguments are for the requested target, not its dependencies
+	if want := "build\nlint --fix -- x\n"; out.String() != want {
+		t.Errorf("Workspace.RunTargets() printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestCheckMakeArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{"ARGS=--fix", "-k", "-B", "--no-print-directory"}},
+		{args: []string{"ARGS=-- x"}},
+		{args: []string{"-f", "other.mk"}, wantErr: true},
+		{args: []string{"--file=other.mk"}, wantErr: true},
+		{args: []string{"VAR=1", "--", "echo"}, wantErr: true},
+		{args: []string{"lint"}, wantErr: true},
+		{args: []string{"=1"}, wantErr: true},
+		{args: []string{"-j", "4", "-C", "dir", "-o", "file.o", "-l", "2.5", "--directory", "dir"}},
+		{args: []string{"-j", "-k"}},
+		{args: []string{"-j", "lint"}, wantErr: true},
+		{args: []string{"-C"}},
+	}
+	for _, tt := range tests {
+		if err := CheckMakeArgs(tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("CheckMakeArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
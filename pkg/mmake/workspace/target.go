@@ -4,96 +4,225 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/aakarim/mmake/internal/makefile"
 )
 
+// RunTarget runs the target after running all of its cross-package dependencies.
 func (w *Workspace) RunTarget(ctx context.Context, target string) error {
+	_, err := w.RunTargets(ctx, RunOptions{}, target)
+	return err
+}
+
+// runTarget runs a single target without its dependencies. If the target
+// declares its inputs and outputs and nothing changed since a previous run,
+// then the outputs are restored from the cache instead and cached is true.
+// depKeys are the cache keys of the label dependencies that already ran, with
+// an empty key for one that ran without the cache. cacheKey is the target's
+// own key, or empty if it ran without the cache. The streams in opts are
+// ignored in favour of the given ones.
+func (w *Workspace) runTarget(ctx context.Context, target string, opts RunOptions, depKeys []string, stdout, stderr io.Writer, stdin io.Reader) (cacheKey string, cached bool, err error) {
+	makeArgs := opts.MakeArgs
 	targetFilePath, err := w.getBuildFile(ctx, target)
 	if err != nil {
-		return err
+		return "", false, err
 	}
-	targetName := getTargetName(target)
-	var args []string
-	if targetFilePath != "" {
-		args = append(args, "-f", targetFilePath)
-		if targetName != "" {
-			args = append(args, targetName)
-		}
+	runnablePath, err := w.runnableBuildFile(targetFilePath)
+	if err != nil {
+		return "", false, err
 	}
-
-	cmd := exec.CommandContext(ctx, "make", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	targetName := Label(target).Target()
 
 	envVars, err := w.buildEnv(targetFilePath)
 	if err != nil {
-		return err
+		return "", false, err
 	}
-	cmd.Env = append(os.Environ(), envVars...)
-	if err := cmd.Run(); err != nil {
-		return &ErrCommand{err}
+
+	spec, err := getCacheSpec(targetFilePath, targetName)
+	if err != nil {
+		return "", false, err
+	}
+	image, err := getImage(targetFilePath, targetName)
+	if err != nil {
+		return "", false, err
+	}
+	if spec != nil {
+		spec.image = image
+	}
+	if HasMakeFlags(makeArgs) {
+		// flags like -n or -B change what make does, so skip the cache
+		spec = nil
+	}
+	if spec != nil {
+		for _, k := range depKeys {
+			if k == "" {
+				// the dependency may have changed the target's inputs in a
+				// way that can't be hashed
+				fmt.Fprintf(stderr, "mmake: a dependency of %s ran without the cache, running it without the cache too\n", target)
+				spec = nil
+				break
+			}
+		}
+	}
+	if spec != nil {
+		spec.dependencies = depKeys
+	}
+	var cacheDir string
+	outDir, err := w.buildOutDir(targetFilePath)
+	if err != nil {
+		return "", false, err
+	}
+	if spec != nil {
+		cacheDir, err = w.cacheDir()
+		if err != nil {
+			return "", false, err
+		}
+		cacheKey, err = w.cacheKey(target, spec, filepath.Dir(targetFilePath), append(append(append([]string{}, w.config.Env...), envVars...), makeArgs...))
+		if errors.Is(err, errNoInputMatches) {
+			// nothing to hash, so the target can't be cached
+			fmt.Fprintf(stderr, "mmake: %v, running %s without the cache\n", err, target)
+			spec, cacheKey = nil, ""
+		} else if err != nil {
+			return "", false, fmt.Errorf("cache key: %w", err)
+		}
+	}
+	if spec != nil {
+		restored, err := restoreOutputs(cacheDir, cacheKey, outDir, spec.outputs)
+		if err != nil {
+			return "", false, err
+		}
+		if restored {
+			fmt.Fprintf(stderr, "mmake: %s is up to date, restored outputs from the cache\n", target)
+			return cacheKey, true, nil
+		}
+	}
+
+	err = w.execute(ctx, &Invocation{
+		Label:        target,
+		Dir:          filepath.Dir(targetFilePath),
+		BuildFile:    targetFilePath,
+		Provider:     providerFor(targetFilePath),
+		Makefile:     runnablePath,
+		Target:       targetName,
+		Args:         makeArgs,
+		DefaultEnv:   w.config.Env,
+		Env:          envVars,
+		Image:        image,
+		ProcessGroup: opts.ProcessGroup,
+		Stdin:        stdin,
+		Stdout:       stdout,
+		Stderr:       stderr,
+	})
+	var exitErr *exec.ExitError
+	var cmdErr *ErrCommand
+	if errors.As(err, &cmdErr) {
+		return "", false, err
+	}
+	if errors.As(err, &exitErr) {
+		return "", false, &ErrCommand{err}
+	}
+	if err != nil {
+		// the executor couldn't run the target at all
+		return "", false, fmt.Errorf("run %s: %w", target, err)
 	}
-	return nil
-}
 
-func getTargetName(target string) string {
-	// strip out leading '//'
-	target = target[2:]
-	// split on ':'
-	if strings.Contains(target, ":") {
-		return strings.Split(target, ":")[1]
+	if spec != nil {
+		if err := storeOutputs(cacheDir, cacheKey, outDir, spec.outputs); err != nil {
+			return "", false, fmt.Errorf("cache outputs of %s: %w", target, err)
+		}
 	}
-	return target
+	return cacheKey, false, nil
 }
 
-func getPackageName(target string) string {
-	// strip out leading '//'
-	target = target[2:]
-	// split on ':'
-	return strings.Split(target, ":")[0]
+// makeCommandArgs returns the arguments to make to run the target in the
+// runnable copy of the build file, see runnableSource.
+func makeCommandArgs(buildFilePath, runnablePath, targetName string, makeArgs []string) []string {
+	args := []string{"-f", runnablePath}
+	if runnablePath != buildFilePath {
+		args = append(args, makefileVariable+"="+buildFilePath)
+	}
+	args = append(args, makeArgs...)
+	if targetName != "" {
+		args = append(args, targetName)
+	}
+	return args
 }
 
-func getRelPathFromTarget(target string) string {
-	// strip out leading '//'
-	target = target[2:]
-	// split on ':'
-	return strings.Split(target, ":")[0]
+// makeValueFlags are the flags of make that take a value, which can be the
+// next argument. The value is optional for those mapped to false, then only a
+// number in the next argument is taken.
+var makeValueFlags = map[string]bool{
+	"-C": true, "--directory": true,
+	"-E": true, "--eval": true,
+	"-I": true, "--include-dir": true,
+	"-o": true, "--old-file": true, "--assume-old": true,
+	"-W": true, "--what-if": true, "--new-file": true, "--assume-new": true,
+	"-j": false, "--jobs": false,
+	"-l": false, "--load-average": false,
 }
 
-func (w *Workspace) getBuildFile(ctx context.Context, target string) (string, error) {
-	target = getRelPathFromTarget(target)
-
-	targetFilePath := ""
-	// check if Makefile exists in dir
-	if err := filepath.WalkDir(filepath.Join(w.rootPath, target), func(path string, d os.DirEntry, err error) error {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if err != nil {
-				return err
-			}
-			if !d.IsDir() && FileIsBuildFile(path) {
-				targetFilePath = path
-				return filepath.SkipDir
+// CheckMakeArgs returns an error if an argument can't be passed to make for
+// a target. Only VAR=value overrides and flags are allowed, and not the
+// flags that change which Makefile is read since mmake sets it.
+func CheckMakeArgs(args []string) error {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, _, _ := strings.Cut(a, "=")
+		if required, ok := makeValueFlags[a]; ok && i+1 < len(args) {
+			if _, err := strconv.ParseFloat(args[i+1], 64); required || err == nil {
+				// the next argument is the value of the flag
+				i++
+				continue
 			}
 		}
-		return nil
-	}); err != nil {
-		return "", err
+		switch {
+		case a == "--":
+			return errors.New("-- must directly follow the labels to import a command")
+		case strings.HasPrefix(a, "-f"), name == "--file", name == "--makefile":
+			return fmt.Errorf("%s can't be passed to make, mmake sets the Makefile", a)
+		case strings.HasPrefix(a, "-"):
+		case strings.Contains(a, "=") && name != "":
+		default:
+			return fmt.Errorf("unexpected argument %q, pass make variables as VAR=value and arguments for the recipe as ARGS=...", a)
+		}
+	}
+	return nil
+}
+
+// HasMakeFlags returns true if any of the make arguments is a flag rather
+// than a variable override.
+func HasMakeFlags(args []string) bool {
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") {
+			return true
+		}
 	}
+	return false
+}
 
-	if targetFilePath == "" {
+// getBuildFile returns the path to the build file of the target's package. A
+// Makefile is preferred over the build files of providers.
+func (w *Workspace) getBuildFile(ctx context.Context, target string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(w.rootPath, Label(target).Path())
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	name := preferredBuildFile(entries)
+	if name == "" {
 		return "", ErrNoMakefileFound
 	}
-	return filepath.Abs(targetFilePath)
+	return filepath.Abs(filepath.Join(dir, name))
 }
 
 func (w *Workspace) GetInfo(ctx context.Context, target string) (string, error) {
@@ -101,6 +230,20 @@ func (w *Workspace) GetInfo(ctx context.Context, target string) (string, error)
 	if err != nil {
 		return "", fmt.Errorf("get build file: %w", err)
 	}
+	targetName := Label(target).Target()
+	if p := providerFor(bf); p != nil {
+		parsed, err := p.Parse(bf)
+		if err != nil {
+			return "", fmt.Errorf("parse build file: %w", err)
+		}
+		if !parsed.HasTarget(targetName) {
+			return "", fmt.Errorf("target not found: %s", targetName)
+		}
+		if desc := parsed.TargetDescriptions[targetName]; desc != "" {
+			return desc, nil
+		}
+		return "no description", nil
+	}
 
 	// load build file and get info
 	f, err := os.Open(bf)
@@ -109,8 +252,6 @@ func (w *Workspace) GetInfo(ctx context.Context, target string) (string, error)
 	}
 	defer f.Close()
 
-	targetName := getTargetName(target)
-
 	t := makefile.GetTarget(targetName, f)
 	if t == nil {
 		return "", fmt.Errorf("target not found: %s", targetName)
@@ -131,34 +272,53 @@ func (w *Workspace) GetInfo(ctx context.Context, target string) (string, error)
 	return "no target body", nil
 }
 
+// buildEnv returns the MM_ variables for the build file and creates its
+// output directory.
 func (w *Workspace) buildEnv(targetFilePath string) ([]string, error) {
-	rel, err := filepath.Rel(w.rootPath, filepath.Dir(targetFilePath))
+	env, err := w.packageEnv(targetFilePath)
 	if err != nil {
 		return nil, err
 	}
-	buildTargetDir := path.Join(w.rootPath, BuildDir, rel)
-	if err := os.MkdirAll(buildTargetDir, 0755); err != nil {
+	outDir, err := w.buildOutDir(targetFilePath)
+	if err != nil {
 		return nil, err
 	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
 
+// packageEnv returns the MM_ variables for the build file.
+func (w *Workspace) packageEnv(targetFilePath string) ([]string, error) {
+	rel, err := filepath.Rel(w.rootPath, filepath.Dir(targetFilePath))
+	if err != nil {
+		return nil, err
+	}
 	return []string{
-		"MM_ROOT=" + filepath.Join(w.rootPath, "WORKSPACE.mmake"),
+		"MM_ROOT=" + filepath.Join(w.rootPath, WorkspaceFile),
 		"MM_PATH=" + filepath.Join(w.rootPath, rel),
-		"MM_OUT_ROOT=" + path.Join(w.rootPath, BuildDir),
-		"MM_OUT_PATH=" + buildTargetDir,
+		"MM_OUT_ROOT=" + w.buildRoot(),
+		"MM_OUT_PATH=" + path.Join(w.buildRoot(), rel),
 		"WS_ROOT=" + w.rootPath,
 	}, nil
 }
 
+// buildOutDir returns the package output directory of the build file.
+func (w *Workspace) buildOutDir(targetFilePath string) (string, error) {
+	rel, err := filepath.Rel(w.rootPath, filepath.Dir(targetFilePath))
+	if err != nil {
+		return "", err
+	}
+	return path.Join(w.buildRoot(), rel), nil
+}
+
 func (w *Workspace) Clean(ctx context.Context, label string) error {
 	if label == "" {
 		return errors.New("you must specify a label to clean")
 	}
 
-	// strip out leading '//'
-	label = label[2:]
-
-	buildTargetDir := path.Join(w.rootPath, BuildDir, label)
+	buildTargetDir := path.Join(w.buildRoot(), Label(label).Path())
 	if err := os.RemoveAll(buildTargetDir); err != nil {
 		return err
 	}
@@ -0,0 +1,219 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	RunOptions
+	// Interval is how often the package directories are checked for
+	// changes, defaults to 500ms
+	Interval time.Duration
+	// Debounce is how long the files have to stay unchanged before the
+	// targets are restarted, so that saving many files at once only restarts
+	// them once. Defaults to 200ms
+	Debounce time.Duration
+}
+
+// fileState is what a change to a watched file is detected from.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch runs the targets and runs them again whenever a file changes in the
+// package directories of the targets or of their cross-package dependencies.
+// Directories are polled, skipping the ignored directories, the build
+// directory and packages below the watched ones. If the targets are still
+// running when files change, then they are cancelled through the context
+// passed to make, along with every process they started, before they are
+// restarted. Watch returns once ctx is done.
+func (w *Workspace) Watch(ctx context.Context, opts WatchOptions, targets ...string) error {
+	if opts.Interval <= 0 {
+		opts.Interval = 500 * time.Millisecond
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 200 * time.Millisecond
+	}
+	opts.ProcessGroup = true
+	if opts.Stdin == nil {
+		// make isn't in the terminal's process group, so it can't read from it
+		opts.Stdin = strings.NewReader("")
+	}
+	stderr := opts.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	g, err := w.resolveGraph(ctx, targets...)
+	if err != nil {
+		return err
+	}
+	dirs := w.watchDirs(g.order)
+	files, err := w.snapshot(dirs)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			_, err := w.RunTargets(runCtx, opts.RunOptions, targets...)
+			done <- err
+		}()
+
+		var changed []string
+		var lastChange time.Time
+		running := true
+		for running || changed == nil || time.Since(lastChange) < opts.Debounce {
+			select {
+			case <-ctx.Done():
+				cancel()
+				if running {
+					<-done
+				}
+				return nil
+			case err := <-done:
+				running = false
+				reportRun(stderr, err)
+			case <-ticker.C:
+				next, err := w.snapshot(dirs)
+				if err != nil {
+					fmt.Fprintf(stderr, "mmake: watch: %v\n", err)
+					continue
+				}
+				if c := changedFiles(files, next); len(c) > 0 {
+					changed = append(changed, c...)
+					lastChange = time.Now()
+				}
+				files = next
+			}
+			if running && changed != nil && time.Since(lastChange) >= opts.Debounce {
+				// stop the running targets so that they can be restarted
+				cancel()
+				<-done
+				running = false
+			}
+		}
+		cancel()
+		fmt.Fprintf(stderr, "mmake: %s changed, restarting\n", w.relPath(changed[0]))
+	}
+}
+
+// reportRun prints how a run of the watched targets ended.
+func reportRun(stderr io.Writer, err error) {
+	if err != nil {
+		fmt.Fprintf(stderr, "mmake: %v, waiting for changes\n", err)
+		return
+	}
+	fmt.Fprintln(stderr, "mmake: done, waiting for changes")
+}
+
+// watchDirs returns the package directories of the targets.
+func (w *Workspace) watchDirs(targets []string) []string {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, t := range targets {
+		dir := filepath.Join(w.rootPath, Label(t).Path())
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// snapshot returns the state of every file in the directories. Ignored
+// files and directories, the build directory and subdirectories with a build
+// file of their own, which are other packages, are skipped.
+func (w *Workspace) snapshot(dirs []string) (map[string]fileState, error) {
+	files := map[string]fileState{}
+	for _, dir := range dirs {
+		above, err := w.ignoreRulesAbove(dir)
+		if err != nil {
+			return nil, err
+		}
+		// rules are the ignore rules for the entries of each directory walked
+		rules := map[string]ignoreRules{}
+		err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					// removed while walking
+					return nil
+				}
+				return err
+			}
+			parentRules := above
+			if p != dir {
+				parentRules = rules[filepath.Dir(p)]
+			}
+			if d.IsDir() {
+				if p != dir && (w.isIgnored(parentRules, p, true) || p == w.buildRoot() || isPackageDir(p)) {
+					return filepath.SkipDir
+				}
+				rules[p], err = w.withIgnoreFiles(parentRules, p)
+				return err
+			}
+			if w.isIgnored(parentRules, p, false) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			files[p] = fileState{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// isPackageDir returns true if the directory has a build file.
+func isPackageDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && FileIsBuildFile(e.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFiles returns the files that were added, removed or modified
+// between the snapshots, sorted by path.
+func changedFiles(before, after map[string]fileState) []string {
+	var changed []string
+	for p, s := range after {
+		if old, ok := before[p]; !ok || !old.modTime.Equal(s.modTime) || old.size != s.size {
+			changed = append(changed, p)
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,101 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkspace_snapshot(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile":             "build:\n",
+		"api/main.go":              "",
+		"api/handlers/handlers.go": "",
+		"api/node_modules/x.js":    "",
+		"api/builder/Makefile":     "build:\n",
+		"build-out/api/ran":        "",
+	})
+	w.ignoreDirs = append(w.ignoreDirs, "node_modules")
+
+	files, err := w.snapshot(w.watchDirs([]string{"//api:build"}))
+	if err != nil {
+		t.Fatalf("Workspace.snapshot() error = %v", err)
+	}
+	var got []string
+	for p := range files {
+		got = append(got, w.relPath(p))
+	}
+	sort.Strings(got)
+	want := []string{"api/Makefile", "api/handlers/handlers.go", "api/main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Workspace.snapshot() = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	now := time.Now()
+	before := map[string]fileState{
+		"same":     {modTime: now, size: 1},
+		"modified": {modTime: now, size: 1},
+		"resized":  {modTime: now, size: 1},
+		"removed":  {modTime: now, size: 1},
+	}
+	after := map[string]fileState{
+		"same":     {modTime: now, size: 1},
+		"modified": {modTime: now.Add(time.Second), size: 1},
+		"resized":  {modTime: now, size: 2},
+		"added":    {modTime: now, size: 1},
+	}
+	want := []string{"added", "modified", "removed", "resized"}
+	if got := changedFiles(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestWorkspace_Watch(t *testing.T) {
+	w := writeWorkspace(t, map[string]string{
+		"api/Makefile": "serve:\n\t@echo start; sleep 10\n",
+		"api/main.go":  "",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	opts := WatchOptions{
+		RunOptions: RunOptions{Stdout: &stdout, Stderr: &stderr},
+		Interval:   10 * time.Millisecond,
+		Debounce:   10 * time.Millisecond,
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Watch(ctx, opts, "//api:serve")
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(w.rootPath, "api", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Workspace.Watch() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Workspace.Watch() didn't return after the context was cancelled")
+	}
+
+	if got := strings.Count(stdout.String(), "start"); got != 2 {
+		t.Errorf("the target started %d times, want 2", got)
+	}
+	if !strings.Contains(stderr.String(), "mmake: api/main.go changed, restarting") {
+		t.Errorf("Workspace.Watch() printed %q, want the changed file", stderr.String())
+	}
+}
@@ -8,28 +8,55 @@ import (
 
 type Workspace struct {
 	rootPath   string
+	config     *Config
 	ignoreDirs []string
+	// readOnly stops the workspace from writing to the build directory
+	readOnly bool
+	// containerEngine runs the targets with an image, if it isn't set then
+	// the CLI from the configuration is used
+	containerEngine ContainerEngine
+	// executor runs the targets, if it isn't set then they run with make
+	executor Executor
 }
 
+// New creates a workspace rooted at rootPath using the default configuration.
 func New(rootPath string) *Workspace {
-	return &Workspace{rootPath: rootPath, ignoreDirs: []string{
-		".git",
-		"build-out",
-		"vendor",
-		"node_modules",
-		"__pycache__",
-		"__snapshots__",
-		"__tests__",
-		"__mocks__",
-		"__fixtures__",
-	}}
+	return NewWithConfig(rootPath, DefaultConfig())
+}
+
+// NewWithConfig creates a workspace rooted at rootPath using the given configuration.
+func NewWithConfig(rootPath string, config *Config) *Workspace {
+	ignoreDirs := make([]string, 0, len(config.IgnoreDirs)+1)
+	ignoreDirs = append(ignoreDirs, config.IgnoreDirs...)
+	ignoreDirs = append(ignoreDirs, config.BuildDir)
+
+	return &Workspace{rootPath: rootPath, config: config, ignoreDirs: ignoreDirs}
+}
+
+// SetReadOnly stops the workspace from creating the build directory or
+// writing the index to it, e.g. for a dry run.
+func (w *Workspace) SetReadOnly(readOnly bool) {
+	w.readOnly = readOnly
+}
+
+// Config returns the configuration of the workspace.
+func (w *Workspace) Config() *Config {
+	return w.config
 }
 
 func (w *Workspace) Init(ctx context.Context) error {
+	if w.readOnly {
+		return nil
+	}
 	// create the build-out directory if it doesn't exist
-	if err := os.MkdirAll(path.Join(w.rootPath, "build-out"), 0755); err != nil {
+	if err := os.MkdirAll(w.buildRoot(), 0755); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// buildRoot returns the absolute path of the build output directory.
+func (w *Workspace) buildRoot() string {
+	return path.Join(w.rootPath, w.config.BuildDir)
+}